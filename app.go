@@ -1,53 +1,457 @@
 package main
 
 import (
-	"log"
+	"context"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const port = ":5002"
 
+type appConfig struct {
+	logBody      bool
+	storageType  string
+	dbPath       string
+	webhooksPath string
+	outboxTarget string
+	grpcAddr     string
+	adminAddr    string
+	tracing      TracingConfig
+	tls          TLSConfig
+	logging      LogConfig
+	redaction    RedactionConfig
+	cors         CORSConfig
+	persistence  PersistenceConfig
+	cache        CacheConfig
+	resilience   ResilienceConfig
+	rateLimits   RateLimitConfig
+	maxBodySize  int64
+	compressMin  int
+}
+
 func main() {
-	logBody := false
-	storage := ""
-
-	args := os.Args
-	if len(args) >= 2 {
-		for i, arg := range args {
-			if arg == "-logBody" {
-				logBody = true
-			}
+	cfg := parseArgs(os.Args)
 
-			if arg == "--storage" || arg == "-s" {
-				if i < len(args)-1 {
-					storage = args[i+1]
-				}
-			}
+	logger, logCloser, err := NewLogger(cfg.logging)
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not configure logging")
+	}
+	log.Logger = logger
+
+	err = run(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("stopped")
+	}
+	logCloser.Close()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func parseArgs(args []string) appConfig {
+	cfg := appConfig{
+		tracing:     TracingConfig{File: defaultTraceFile},
+		logging:     DefaultLogConfig(),
+		redaction:   DefaultRedactionConfig(),
+		cors:        DefaultCORSConfig(),
+		persistence: DefaultPersistenceConfig(),
+		cache:       DefaultCacheConfig(),
+		resilience:  DefaultResilienceConfig(),
+		maxBodySize: defaultMaxBodySize,
+		compressMin: defaultCompressionMinSize,
+	}
+	cfg.redaction.Key = []byte(os.Getenv(logRedactKeyEnv))
+
+	value := func(i int) string {
+		if i < len(args)-1 {
+			return args[i+1]
+		}
+		return ""
+	}
+	for i, arg := range args {
+		switch arg {
+		case "-logBody":
+			cfg.logBody = true
+		case "--storage", "-s":
+			cfg.storageType = value(i)
+		case "--db":
+			cfg.dbPath = value(i)
+		case "--data-dir":
+			cfg.persistence.Dir = value(i)
+		case "--wal-sync":
+			cfg.persistence.Sync = value(i)
+		case "--wal-sync-interval":
+			cfg.persistence.SyncInterval = durationArg(arg, value(i))
+		case "--snapshot-interval":
+			cfg.persistence.SnapshotInterval = durationArg(arg, value(i))
+		case "--webhooks":
+			cfg.webhooksPath = value(i)
+		case "--grpc":
+			cfg.grpcAddr = value(i)
+		case "--admin":
+			cfg.adminAddr = value(i)
+		case "--trace-exporter":
+			cfg.tracing.Exporter = value(i)
+		case "--trace-endpoint":
+			cfg.tracing.Endpoint = value(i)
+		case "--trace-file":
+			cfg.tracing.File = value(i)
+		case "--tls-cert":
+			cfg.tls.CertFile = value(i)
+		case "--tls-key":
+			cfg.tls.KeyFile = value(i)
+		case "--tls-client-ca":
+			cfg.tls.ClientCAFile = value(i)
+		case "--tls-client-auth":
+			cfg.tls.ClientAuth = value(i)
+		case "--outbox":
+			cfg.outboxTarget = value(i)
+		case "--log-output":
+			cfg.logging.Output = value(i)
+		case "--log-file":
+			cfg.logging.File = value(i)
+		case "--log-level":
+			cfg.logging.Level = value(i)
+		case "--log-max-size":
+			cfg.logging.MaxSize = int64(intArg(arg, value(i))) << 20
+		case "--log-max-age":
+			cfg.logging.MaxAge = durationArg(arg, value(i))
+		case "--log-max-backups":
+			cfg.logging.MaxBackups = intArg(arg, value(i))
+		case "--log-redact":
+			cfg.redaction.Mode = RedactionMode(value(i))
+		case "--log-redact-fields":
+			cfg.redaction.Fields = strings.Split(value(i), ",")
+		case "--log-body-max":
+			cfg.redaction.MaxBody = intArg(arg, value(i))
+		case "--max-body-size":
+			cfg.maxBodySize = int64(intArg(arg, value(i)))
+		case "--compress-min-size":
+			cfg.compressMin = intArg(arg, value(i))
+		case "--cors-origins":
+			cfg.cors.AllowedOrigins = strings.Split(value(i), ",")
+		case "--cors-credentials":
+			cfg.cors.AllowCredentials = true
+		case "--cache-size":
+			cfg.cache.Size = intArg(arg, value(i))
+		case "--cache-ttl":
+			cfg.cache.TTL = durationArg(arg, value(i))
+		case "--cache-negative-ttl":
+			cfg.cache.NegativeTTL = durationArg(arg, value(i))
+		case "--storage-timeout":
+			cfg.resilience.Timeout = durationArg(arg, value(i))
+		case "--storage-attempts":
+			cfg.resilience.MaxAttempts = intArg(arg, value(i))
+		case "--breaker-failures":
+			cfg.resilience.FailureThreshold = intArg(arg, value(i))
+		case "--breaker-open":
+			cfg.resilience.OpenTimeout = durationArg(arg, value(i))
+		case "--rate-limit":
+			cfg.rateLimits.User.Rate = floatArg(arg, value(i))
+		case "--rate-burst":
+			cfg.rateLimits.User.Burst = intArg(arg, value(i))
+		case "--rate-limit-ip":
+			cfg.rateLimits.Anonymous.Rate = floatArg(arg, value(i))
+		case "--rate-burst-ip":
+			cfg.rateLimits.Anonymous.Burst = intArg(arg, value(i))
+		}
+	}
+	return cfg
+}
+
+// run wires the service together and blocks until it is told to stop. Everything
+// it starts is registered on the lifecycle, so it is also released when setup fails halfway.
+func run(cfg appConfig) (err error) {
+	lc := NewLifecycle(shutdownTimeout)
+	defer func() {
+		if shutdownErr := lc.Shutdown(); err == nil {
+			err = shutdownErr
 		}
+	}()
+
+	redactor, err := NewRedactor(cfg.redaction)
+	if err != nil {
+		return err
 	}
 
-	var server *Server
-	switch storage {
+	if cfg.tracing.Exporter != "" {
+		provider, shutdown, err := NewTracerProvider(context.Background(), cfg.tracing)
+		if err != nil {
+			return err
+		}
+		lc.OnShutdown("tracing", shutdown)
+		otel.SetTracerProvider(provider)
+	}
+
+	var cors *CORS
+	if len(cfg.cors.AllowedOrigins) != 0 {
+		if cors, err = NewCORS(cfg.cors); err != nil {
+			return err
+		}
+	}
+
+	bus := NewEventBus(eventBufferSize)
+	opts := []ServerOption{
+		WithEventBus(bus),
+		WithLogger(log.Logger),
+		WithRedactor(redactor),
+		WithRateLimiter(NewMemoryRateLimiter(), cfg.rateLimits),
+		WithMaxBodySize(cfg.maxBodySize),
+		WithCompression(cfg.compressMin),
+		WithCORS(cors),
+	}
+	var listeners []EventListener
+	// watch follows the changes made by other instances.
+	var watch func(context.Context, EventListener)
+
+	storageType := cfg.storageType
+	var storage Storage
+	switch storageType {
 	case "mongo":
-		storage, err := NewMongoStorage()
+		mongoStorage, err := NewMongoStorage()
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		defer storage.Close()
-		server = NewServer(storage, logBody)
+		lc.OnShutdown("mongo", mongoStorage.Close)
+		storage = mongoStorage
+		watch = mongoStorage.WatchEvents
 	case "postgres":
-		storage, err := NewPostgresStorage()
+		postgresStorage, err := NewPostgresStorage()
 		if err != nil {
-			log.Panic(err)
+			return err
 		}
-		server = NewServer(storage, logBody)
+		lc.Close("postgres", postgresStorage.Close)
+		storage = postgresStorage
+		listeners = append(listeners, postgresStorage.NotifyEvent)
+		watch = postgresStorage.ListenEvents
+
+		if cfg.outboxTarget != "" {
+			if err := postgresStorage.EnableOutbox(); err != nil {
+				return err
+			}
+			var out io.Writer = os.Stdout
+			if cfg.outboxTarget != "stdout" {
+				f, err := os.OpenFile(cfg.outboxTarget, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+				if err != nil {
+					return err
+				}
+				lc.Close("outbox file", f.Close)
+				out = f
+			}
+			relay := NewOutboxRelay(postgresStorage, NewWriterPublisher(out))
+			lc.Go("outbox relay", relay.Run)
+		}
+	case "sqlite":
+		sqliteStorage, err := NewSQLiteStorage(pathOr(cfg.dbPath, defaultSQLitePath))
+		if err != nil {
+			return err
+		}
+		lc.Close("sqlite", sqliteStorage.Close)
+		storage = sqliteStorage
+		listeners = append(listeners, bus.Publish)
+	case "bolt":
+		boltStorage, err := NewBoltStorage(pathOr(cfg.dbPath, defaultBoltPath))
+		if err != nil {
+			return err
+		}
+		lc.Close("bolt", boltStorage.Close)
+		storage = boltStorage
+		listeners = append(listeners, bus.Publish)
 	default:
-		storage := NewInMemoryPersonStorage()
-		server = NewServer(storage, logBody)
+		storageType = "memory"
+		storage = NewInMemoryPersonStorage()
+		if cfg.persistence.Dir != "" {
+			memoryStorage, err := OpenInMemoryPersonStorage(cfg.persistence)
+			if err != nil {
+				return err
+			}
+			lc.Close("memory", memoryStorage.Close)
+			lc.Go("snapshots", memoryStorage.Run)
+			storage = memoryStorage
+		}
+		listeners = append(listeners, bus.Publish)
+	}
+
+	health := NewHealth(healthCheckTimeout)
+	if pinger, ok := storage.(Pinger); ok {
+		health.AddCheck(storageType, pinger.Ping)
+	}
+	metrics := NewMetrics()
+	if counter, ok := storage.(PersonCounter); ok {
+		metrics.RegisterPersonCount(counter)
+	}
+	if storageType != "memory" {
+		storage = NewResilientStorage(storage, cfg.resilience)
+	}
+	opts = append(opts, WithHealth(health))
+
+	storage = NewMetricsStorage(storage, storageType, metrics)
+	opts = append(opts, WithMetrics(metrics, cfg.adminAddr == ""))
+
+	publish := bus.Publish
+	if cfg.cache.Size > 0 {
+		cache := NewCachingStorage(storage, cfg.cache)
+		metrics.RegisterCache(cache)
+		storage = cache
+		publish = func(e *PersonEvent) {
+			cache.Invalidate(e)
+			bus.Publish(e)
+		}
+	}
+	if watch != nil {
+		lc.Go(storageType+" events", func(ctx context.Context) { watch(ctx, publish) })
+	}
+
+	if cfg.webhooksPath != "" {
+		store, err := NewWebhookStore(cfg.webhooksPath)
+		if err != nil {
+			return err
+		}
+		dispatcher := NewWebhookDispatcher(store)
+		dispatcher.Start()
+		lc.OnShutdown("webhooks", dispatcher.Stop)
+
+		listeners = append(listeners, dispatcher.Publish)
+		opts = append(opts, WithWebhooks(dispatcher))
+	}
+	if len(listeners) != 0 {
+		storage = NewEventStorage(storage, listeners...)
+	}
+	if cfg.tracing.Exporter != "" {
+		storage = NewTracingStorage(storage, storageType)
+	}
+	server := NewServer(storage, cfg.logBody, opts...)
+
+	var certs *CertReloader
+	if cfg.tls.CertFile != "" {
+		if certs, err = NewCertReloader(cfg.tls); err != nil {
+			return err
+		}
+		lc.Go("tls reload", certs.Watch)
+	}
+
+	if cfg.grpcAddr != "" {
+		lis, err := net.Listen("tcp", cfg.grpcAddr)
+		if err != nil {
+			return err
+		}
+		var grpcOpts []grpc.ServerOption
+		if certs != nil {
+			// The same certificates and client authentication as the HTTP server.
+			grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(certs.TLSConfig())))
+		}
+		grpcServer := NewGRPCServer(storage, grpcOpts...)
+		lc.Serve("grpc server", func() error { return grpcServer.Serve(lis) }, func(ctx context.Context) error {
+			return stopGRPC(ctx, grpcServer)
+		})
 	}
 
-	if err := http.ListenAndServe(port, server); err != nil {
-		log.Fatalf("could not listen on port %v %v", port, err)
+	if cfg.adminAddr != "" {
+		adminServer := newHTTPServer(cfg.adminAddr, NewAdminHandler(metrics, health))
+		lc.Serve("admin server", adminServer.ListenAndServe, shutdownHTTP(adminServer))
+	}
+
+	httpServer := newHTTPServer(port, server)
+	httpServer.RegisterOnShutdown(bus.Close)
+	serve := httpServer.ListenAndServe
+	if certs != nil {
+		httpServer.TLSConfig = certs.TLSConfig()
+		serve = func() error { return httpServer.ListenAndServeTLS("", "") }
+	}
+	lc.Serve("http server", serve, shutdownHTTP(httpServer))
+
+	// Fail readiness first and give load balancers time to notice before the servers stop accepting connections.
+	lc.OnShutdown("drain", func(ctx context.Context) error {
+		health.Drain()
+		select {
+		case <-time.After(shutdownDrainDelay):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	log.Info().Str("addr", port).Str("storage", storageType).Bool("tls", cfg.tls.CertFile != "").Msg("listening")
+	return lc.Wait()
+}
+
+// newHTTPServer bounds how long a client may take to send a request and read the response,
+// so slow clients can't hold connections open indefinitely.
+func newHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+}
+
+// shutdownHTTP waits for in-flight requests and closes the connections that are still open at the deadline.
+func shutdownHTTP(server *http.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		err := server.Shutdown(ctx)
+		if err != nil {
+			server.Close()
+		}
+		return err
+	}
+}
+
+func stopGRPC(ctx context.Context, server *grpc.Server) error {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		server.Stop()
+		return ctx.Err()
+	}
+}
+
+func intArg(name, value string) int {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("invalid %v", name)
+	}
+	return n
+}
+
+func floatArg(name, value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("invalid %v", name)
+	}
+	return f
+}
+
+func durationArg(name, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatal().Err(err).Msgf("invalid %v", name)
+	}
+	return d
+}
+
+func pathOr(path, fallback string) string {
+	if path == "" {
+		return fallback
 	}
+	return path
 }
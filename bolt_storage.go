@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+
+	uuid "github.com/satori/go.uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	personsBucket                = []byte("persons")
+	personsByNameBucket          = []byte("persons_by_name")
+	personsByCommunicationBucket = []byte("persons_by_communication")
+)
+
+// BoltStorage keeps persons in an embedded bbolt file, keyed by id. The name and
+// communication indexes map "value\x00id" keys to nothing, so the persons with a
+// given value are a prefix scan away. Indexes change in the same transaction as
+// the person, so they never disagree with it. Long values are indexed by their
+// hash, which keeps keys under the bbolt limit.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{personsBucket, personsByNameBucket, personsByCommunicationBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{db: db}, nil
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// Ping fails once the database is closed.
+func (s *BoltStorage) Ping(context.Context) error {
+	return s.db.View(func(*bolt.Tx) error { return nil })
+}
+
+func (s *BoltStorage) Count(context.Context) (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(personsBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+func (s *BoltStorage) GetAll() ([]*Person, error) {
+	var pp []*Person
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(personsBucket).ForEach(func(_, v []byte) error {
+			p := &Person{}
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			pp = append(pp, p)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	} else if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+	return pp, nil
+}
+
+func (s *BoltStorage) Add(p *Person) (*Person, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(personsBucket).Get(p.ID.Bytes()) != nil {
+			return personExistError
+		}
+		return putPerson(tx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPersonByID(p.ID)
+}
+
+func (s *BoltStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	var p *Person
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		p, err = getPerson(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *BoltStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	pp := []*Person{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, id := range ids {
+			p, err := getPerson(tx, id)
+			if err == personNotFoundError {
+				continue
+			} else if err != nil {
+				return err
+			}
+			pp = append(pp, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pp, nil
+}
+
+func (s *BoltStorage) GetPersonsByName(name string) ([]*Person, error) {
+	return s.lookup(personsByNameBucket, name, func(p *Person) bool { return p.Name == name })
+}
+
+func (s *BoltStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	return s.lookup(personsByCommunicationBucket, value, func(p *Person) bool {
+		for _, com := range p.Communications {
+			if com.Value == value {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// lookup returns the persons the index lists under value. match weeds out any
+// person whose key only looks the same, e.g. a long value with the same hash.
+func (s *BoltStorage) lookup(index []byte, value string, match func(*Person) bool) ([]*Person, error) {
+	pp := []*Person{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := indexKey(value, uuid.Nil)
+		prefix := key[:len(key)-uuid.Size]
+		c := tx.Bucket(index).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			// A longer value may start with value and the separator, its key is longer than ours.
+			if len(k) != len(prefix)+uuid.Size {
+				continue
+			}
+			p, err := getPerson(tx, uuid.FromBytesOrNil(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if match(p) {
+				pp = append(pp, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+	return pp, nil
+}
+
+func (s *BoltStorage) UpdatePerson(p *Person) (*Person, error) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		old, err := getPerson(tx, p.ID)
+		if err != nil {
+			return err
+		}
+		if err := unindexPerson(tx, old); err != nil {
+			return err
+		}
+		return putPerson(tx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPersonByID(p.ID)
+}
+
+func (s *BoltStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	var p *Person
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if p, err = getPerson(tx, id); err != nil {
+			return err
+		}
+		if err := unindexPerson(tx, p); err != nil {
+			return err
+		}
+		return tx.Bucket(personsBucket).Delete(id.Bytes())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func getPerson(tx *bolt.Tx, id uuid.UUID) (*Person, error) {
+	v := tx.Bucket(personsBucket).Get(id.Bytes())
+	if v == nil {
+		return nil, personNotFoundError
+	}
+	p := &Person{}
+	if err := json.Unmarshal(v, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// putPerson stores the person and adds it to the indexes.
+func putPerson(tx *bolt.Tx, p *Person) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(personsBucket).Put(p.ID.Bytes(), data); err != nil {
+		return err
+	}
+	if err := tx.Bucket(personsByNameBucket).Put(indexKey(p.Name, p.ID), nil); err != nil {
+		return err
+	}
+	for _, com := range p.Communications {
+		if err := tx.Bucket(personsByCommunicationBucket).Put(indexKey(com.Value, p.ID), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unindexPerson(tx *bolt.Tx, p *Person) error {
+	if err := tx.Bucket(personsByNameBucket).Delete(indexKey(p.Name, p.ID)); err != nil {
+		return err
+	}
+	for _, com := range p.Communications {
+		if err := tx.Bucket(personsByCommunicationBucket).Delete(indexKey(com.Value, p.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKey returns "value\x00id", with values longer than boltMaxIndexValue
+// replaced by 0xff and their SHA-256, which no UTF-8 value starts with.
+func indexKey(value string, id uuid.UUID) []byte {
+	v := []byte(value)
+	if len(v) > boltMaxIndexValue {
+		sum := sha256.Sum256(v)
+		v = append([]byte{0xff}, sum[:]...)
+	}
+	key := make([]byte, 0, len(v)+1+uuid.Size)
+	key = append(key, v...)
+	key = append(key, 0)
+	return append(key, id.Bytes()...)
+}
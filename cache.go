@@ -0,0 +1,239 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+type CacheConfig struct {
+	// Size caps the number of cached persons; 0 disables the cache.
+	Size        int
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{TTL: defaultCacheTTL, NegativeTTL: defaultCacheNegativeTTL}
+}
+
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// CachingStorage serves person lookups by id from an LRU cache. Concurrent
+// misses for the same id share one backend call, and ids that don't exist are
+// remembered for NegativeTTL. Writes through it drop the entry; writes made
+// elsewhere show up after TTL, or right away when their events reach Invalidate.
+type CachingStorage struct {
+	Storage
+	*cacheState
+	ctx context.Context
+}
+
+// cacheState is shared by the storage and the copies WithContext makes of it.
+type cacheState struct {
+	cfg    CacheConfig
+	now    func() time.Time
+	loads  singleflight.Group
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	mu      sync.Mutex
+	entries map[uuid.UUID]*list.Element
+	lru     *list.List
+	// version changes on every invalidation, so a load that raced with a write isn't cached.
+	version uint64
+}
+
+type cacheEntry struct {
+	id      uuid.UUID
+	person  *Person
+	expires time.Time
+}
+
+func NewCachingStorage(storage Storage, cfg CacheConfig) *CachingStorage {
+	return &CachingStorage{
+		Storage: storage,
+		cacheState: &cacheState{
+			cfg:     cfg,
+			now:     time.Now,
+			entries: make(map[uuid.UUID]*list.Element),
+			lru:     list.New(),
+		},
+	}
+}
+
+// WithContext returns the cache loading through the storage bound to ctx. A load
+// shared by concurrent misses keeps the values of the context of the one that started
+// it, but not its cancellation: it is bounded by storageTimeout instead, so one caller
+// going away doesn't fail the others.
+func (s *CachingStorage) WithContext(ctx context.Context) Storage {
+	return &CachingStorage{Storage: storageWithContext(s.Storage, ctx), cacheState: s.cacheState, ctx: ctx}
+}
+
+func (s *CachingStorage) Stats() CacheStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return CacheStats{Hits: s.hits.Load(), Misses: s.misses.Load(), Entries: s.lru.Len()}
+}
+
+// get returns the cached person, nil for a cached miss, and false when the id isn't cached.
+func (s *CachingStorage) get(id uuid.UUID) (*Person, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*cacheEntry)
+	if s.now().After(e.expires) {
+		s.lru.Remove(el)
+		delete(s.entries, id)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	return e.person, true
+}
+
+func (s *CachingStorage) put(id uuid.UUID, p *Person, version uint64) {
+	ttl := s.cfg.TTL
+	if p == nil {
+		ttl = s.cfg.NegativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version != s.version {
+		return
+	}
+	e := &cacheEntry{id: id, person: p, expires: s.now().Add(ttl)}
+	if el, ok := s.entries[id]; ok {
+		el.Value = e
+		s.lru.MoveToFront(el)
+		return
+	}
+	s.entries[id] = s.lru.PushFront(e)
+	for s.lru.Len() > s.cfg.Size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+func (s *CachingStorage) currentVersion() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+func (s *CachingStorage) forget(id uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	if el, ok := s.entries[id]; ok {
+		s.lru.Remove(el)
+		delete(s.entries, id)
+	}
+}
+
+// Invalidate satisfies EventListener, so changes made by other instances can evict entries too.
+func (s *CachingStorage) Invalidate(e *PersonEvent) {
+	s.forget(e.PersonID)
+}
+
+func (s *CachingStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	if p, ok := s.get(id); ok {
+		s.hits.Add(1)
+		if p == nil {
+			return nil, personNotFoundError
+		}
+		return p, nil
+	}
+	s.misses.Add(1)
+
+	v, err, _ := s.loads.Do(id.String(), func() (interface{}, error) {
+		storage := s.Storage
+		if s.ctx != nil {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(s.ctx), storageTimeout)
+			defer cancel()
+			storage = storageWithContext(storage, ctx)
+		}
+
+		version := s.currentVersion()
+		p, err := storage.GetPersonByID(id)
+		if err == nil {
+			s.put(id, p, version)
+		} else if err == personNotFoundError {
+			s.put(id, nil, version)
+		}
+		return p, err
+	})
+	p, _ := v.(*Person)
+	return p, err
+}
+
+// GetPersonsByIDs loads only the ids that aren't cached and keeps the order of ids.
+func (s *CachingStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	found := make(map[uuid.UUID]*Person, len(ids))
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if p, ok := s.get(id); ok {
+			s.hits.Add(1)
+			if p != nil {
+				found[id] = p
+			}
+			continue
+		}
+		s.misses.Add(1)
+		missing = append(missing, id)
+	}
+
+	if len(missing) != 0 {
+		version := s.currentVersion()
+		pp, err := s.Storage.GetPersonsByIDs(missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pp {
+			found[p.ID] = p
+		}
+		for _, id := range missing {
+			s.put(id, found[id], version)
+		}
+	}
+
+	persons := []*Person{}
+	for _, id := range ids {
+		if p, ok := found[id]; ok {
+			persons = append(persons, p)
+		}
+	}
+	return persons, nil
+}
+
+func (s *CachingStorage) Add(person *Person) (*Person, error) {
+	defer s.forget(person.ID)
+	return s.Storage.Add(person)
+}
+
+func (s *CachingStorage) UpdatePerson(person *Person) (*Person, error) {
+	defer s.forget(person.ID)
+	return s.Storage.UpdatePerson(person)
+}
+
+func (s *CachingStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	defer s.forget(id)
+	return s.Storage.DeletePerson(id)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// backendStub counts the lookups that reach the backend and can hold them until release is closed.
+type backendStub struct {
+	Storage
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *backendStub) GetPersonByID(id uuid.UUID) (*Person, error) {
+	s.calls.Add(1)
+	if s.release != nil {
+		s.started <- struct{}{}
+		<-s.release
+	}
+	return s.Storage.GetPersonByID(id)
+}
+
+func (s *backendStub) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	s.calls.Add(int32(len(ids)))
+	return s.Storage.GetPersonsByIDs(ids)
+}
+
+func (s *backendStub) WithContext(ctx context.Context) Storage {
+	return &boundBackendStub{backendStub: s, ctx: ctx}
+}
+
+// boundBackendStub gives up on a held lookup when its context is done.
+type boundBackendStub struct {
+	*backendStub
+	ctx context.Context
+}
+
+func (s *boundBackendStub) GetPersonByID(id uuid.UUID) (*Person, error) {
+	s.calls.Add(1)
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+	return s.Storage.GetPersonByID(id)
+}
+
+func TestCachingStorage(t *testing.T) {
+	joe := &Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"), Name: "Joe"}
+	louis := &Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69535"), Name: "Louis"}
+	unknown := uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69536")
+
+	setup := func(size int) (*CachingStorage, *backendStub, *time.Time) {
+		backend := &backendStub{Storage: NewInMemoryPersonStorage()}
+		backend.Add(joe)
+		backend.Add(louis)
+		cache := NewCachingStorage(backend, CacheConfig{Size: size, TTL: time.Minute, NegativeTTL: time.Second})
+		now := time.Now()
+		cache.now = func() time.Time { return now }
+		return cache, backend, &now
+	}
+	assertCalls := func(t *testing.T, backend *backendStub, want int32) {
+		t.Helper()
+		if got := backend.calls.Load(); got != want {
+			t.Errorf("backend calls = %d, want %d", got, want)
+		}
+	}
+
+	t.Run("hit", func(t *testing.T) {
+		cache, backend, now := setup(10)
+		cache.GetPersonByID(joe.ID)
+		p, err := cache.GetPersonByID(joe.ID)
+
+		if err != nil || p.Name != "Joe" {
+			t.Fatalf("got %v, %v", p, err)
+		}
+		assertCalls(t, backend, 1)
+		if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+			t.Errorf("stats = %+v", stats)
+		}
+
+		*now = now.Add(2 * time.Minute)
+		cache.GetPersonByID(joe.ID)
+		assertCalls(t, backend, 2)
+	})
+
+	t.Run("negative lookups", func(t *testing.T) {
+		cache, backend, now := setup(10)
+		for i := 0; i < 3; i++ {
+			if _, err := cache.GetPersonByID(unknown); err != personNotFoundError {
+				t.Fatalf("err = %v", err)
+			}
+		}
+		assertCalls(t, backend, 1)
+
+		*now = now.Add(2 * time.Second)
+		cache.GetPersonByID(unknown)
+		assertCalls(t, backend, 2)
+	})
+
+	t.Run("size cap evicts the least recently used", func(t *testing.T) {
+		cache, backend, _ := setup(2)
+		cache.GetPersonByID(joe.ID)
+		cache.GetPersonByID(louis.ID)
+		cache.GetPersonByID(joe.ID)
+		cache.GetPersonByID(unknown)
+		assertCalls(t, backend, 3)
+
+		cache.GetPersonByID(joe.ID)
+		assertCalls(t, backend, 3)
+		cache.GetPersonByID(louis.ID)
+		assertCalls(t, backend, 4)
+	})
+
+	t.Run("writes invalidate", func(t *testing.T) {
+		cache, _, _ := setup(10)
+		cache.GetPersonByID(joe.ID)
+		cache.GetPersonByID(unknown)
+
+		cache.UpdatePerson(&Person{ID: joe.ID, Name: "Joseph"})
+		cache.Add(&Person{ID: unknown, Name: "New"})
+
+		if p, _ := cache.GetPersonByID(joe.ID); p.Name != "Joseph" {
+			t.Errorf("got %v after update", p.Name)
+		}
+		if p, err := cache.GetPersonByID(unknown); err != nil || p.Name != "New" {
+			t.Errorf("got %v, %v after add", p, err)
+		}
+		cache.DeletePerson(unknown)
+		if _, err := cache.GetPersonByID(unknown); err != personNotFoundError {
+			t.Errorf("err = %v after delete", err)
+		}
+	})
+
+	t.Run("events invalidate", func(t *testing.T) {
+		cache, backend, _ := setup(10)
+		cache.GetPersonByID(joe.ID)
+
+		cache.Invalidate(NewPersonEvent(PersonUpdated, joe))
+		cache.GetPersonByID(joe.ID)
+		assertCalls(t, backend, 2)
+	})
+
+	t.Run("batch lookups", func(t *testing.T) {
+		cache, backend, _ := setup(10)
+		cache.GetPersonByID(joe.ID)
+
+		pp, err := cache.GetPersonsByIDs([]uuid.UUID{louis.ID, unknown, joe.ID})
+		if err != nil || len(pp) != 2 || pp[0].ID != louis.ID || pp[1].ID != joe.ID {
+			t.Fatalf("got %v, %v", pp, err)
+		}
+		assertCalls(t, backend, 3)
+
+		cache.GetPersonsByIDs([]uuid.UUID{louis.ID, unknown})
+		cache.GetPersonByID(unknown)
+		assertCalls(t, backend, 3)
+	})
+
+	t.Run("concurrent misses are coalesced", func(t *testing.T) {
+		cache, backend, _ := setup(10)
+		backend.started, backend.release = make(chan struct{}, 10), make(chan struct{})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if p, err := cache.GetPersonByID(joe.ID); err != nil || p.Name != "Joe" {
+					t.Errorf("got %v, %v", p, err)
+				}
+			}()
+		}
+		<-backend.started
+		// Give the other lookups time to join the one in flight.
+		time.Sleep(20 * time.Millisecond)
+		close(backend.release)
+		wg.Wait()
+
+		assertCalls(t, backend, 1)
+	})
+
+	t.Run("a load racing a write isn't cached", func(t *testing.T) {
+		cache, backend, _ := setup(10)
+		backend.started, backend.release = make(chan struct{}, 10), make(chan struct{})
+
+		done := make(chan struct{})
+		go func() {
+			cache.GetPersonByID(joe.ID)
+			close(done)
+		}()
+		<-backend.started
+		cache.DeletePerson(joe.ID)
+		close(backend.release)
+		<-done
+
+		backend.release = nil
+		if _, err := cache.GetPersonByID(joe.ID); err != personNotFoundError {
+			t.Errorf("err = %v, want the deleted person to be gone", err)
+		}
+	})
+	t.Run("a cancelled caller doesn't fail a shared load", func(t *testing.T) {
+		cache, backend, _ := setup(10)
+		backend.started, backend.release = make(chan struct{}, 10), make(chan struct{})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go cache.WithContext(ctx).GetPersonByID(joe.ID)
+		<-backend.started
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if p, err := cache.WithContext(context.Background()).GetPersonByID(joe.ID); err != nil || p.Name != "Joe" {
+				t.Errorf("got %v, %v", p, err)
+			}
+		}()
+		// Give the second lookup time to join the one in flight.
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		time.Sleep(20 * time.Millisecond)
+		close(backend.release)
+		<-done
+
+		assertCalls(t, backend, 1)
+	})
+}
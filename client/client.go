@@ -0,0 +1,313 @@
+// Package client is a typed Go client for the person service HTTP API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	contentTypeJSON  = "application/json"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+type Person struct {
+	ID             uuid.UUID        `json:"id" yaml:"id"`
+	Name           string           `json:"name" yaml:"name"`
+	Communications []*Communication `json:"communications" yaml:"communications"`
+}
+
+type Communication struct {
+	Value string `json:"value" yaml:"value"`
+}
+
+// Authenticator adds credentials to every outgoing request.
+type Authenticator interface {
+	Authenticate(*http.Request) error
+}
+
+type AuthenticatorFunc func(*http.Request) error
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a BasicAuth) Authenticate(r *http.Request) error {
+	r.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	auth        Authenticator
+	maxRetries  int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+func WithAuth(auth Authenticator) Option {
+	return func(client *Client) {
+		client.auth = auth
+	}
+}
+
+// WithRetries retries idempotent requests up to maxRetries times on network
+// errors, 429 and 5xx responses, doubling the wait from base up to max. A
+// Retry-After header on the response makes the wait at least that long.
+func WithRetries(maxRetries int, base, max time.Duration) Option {
+	return func(client *Client) {
+		client.maxRetries = maxRetries
+		client.baseBackoff = base
+		client.maxBackoff = max
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		httpClient:  http.DefaultClient,
+		baseBackoff: 100 * time.Millisecond,
+		maxBackoff:  5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Create(ctx context.Context, p *Person) (*Person, error) {
+	created := &Person{}
+	if err := c.do(ctx, http.MethodPost, "/person", p, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (c *Client) Get(ctx context.Context, id uuid.UUID) (*Person, error) {
+	p := &Person{}
+	if err := c.do(ctx, http.MethodGet, "/person/"+id.String(), nil, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update replaces the person, creating it when it does not exist yet.
+func (c *Client) Update(ctx context.Context, p *Person) (*Person, error) {
+	updated := &Person{}
+	if err := c.do(ctx, http.MethodPut, "/person", p, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (c *Client) Delete(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, http.MethodDelete, "/person/"+id.String(), nil, nil)
+}
+
+// FindByName returns the persons with the given name. No match is not an error.
+func (c *Client) FindByName(ctx context.Context, name string) ([]*Person, error) {
+	return c.find(ctx, url.Values{"name": {name}})
+}
+
+// FindByCommunication returns the persons with the given communication value. No match is not an error.
+func (c *Client) FindByCommunication(ctx context.Context, value string) ([]*Person, error) {
+	return c.find(ctx, url.Values{"communication": {value}})
+}
+
+func (c *Client) find(ctx context.Context, query url.Values) ([]*Person, error) {
+	var pp []*Person
+	err := c.do(ctx, http.MethodGet, "/person?"+query.Encode(), nil, &pp)
+	if errors.Is(err, ErrNotFound) {
+		return []*Person{}, nil
+	}
+	return pp, err
+}
+
+// List returns an iterator over all persons, fetched pageSize at a time.
+func (c *Client) List(ctx context.Context, pageSize int) *PageIterator {
+	return &PageIterator{client: c, ctx: ctx, pageSize: pageSize}
+}
+
+// PageIterator walks the person list page by page:
+//
+//	it := c.List(ctx, 100)
+//	for it.Next() {
+//		for _, p := range it.Page() { ... }
+//	}
+//	if err := it.Err(); err != nil { ... }
+type PageIterator struct {
+	client   *Client
+	ctx      context.Context
+	pageSize int
+	cursor   string
+	page     []*Person
+	done     bool
+	err      error
+}
+
+func (it *PageIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	query := url.Values{"limit": {strconv.Itoa(it.pageSize)}}
+	if it.cursor != "" {
+		query.Set("after", it.cursor)
+	}
+
+	var page []*Person
+	header, err := it.client.doWithHeader(it.ctx, http.MethodGet, "/person?"+query.Encode(), nil, &page)
+	if errors.Is(err, ErrNotFound) {
+		it.done = true
+		return false
+	} else if err != nil {
+		it.err = err
+		return false
+	}
+
+	it.page = page
+	it.cursor = header.Get(nextCursorHeader)
+	it.done = it.cursor == ""
+	return len(page) != 0
+}
+
+func (it *PageIterator) Page() []*Person {
+	return it.page
+}
+
+func (it *PageIterator) Err() error {
+	return it.err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	_, err := c.doWithHeader(ctx, method, path, in, out)
+	return err
+}
+
+func (c *Client) doWithHeader(ctx context.Context, method, path string, in, out interface{}) (http.Header, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	retries := 0
+	if method != http.MethodPost {
+		retries = c.maxRetries
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, body)
+		if err == nil && !retryableStatus(resp.StatusCode) || attempt >= retries {
+			if err != nil {
+				return nil, err
+			}
+			return resp.Header, decodeResponse(resp, out)
+		}
+		wait := c.backoff(attempt)
+		if resp != nil {
+			// The server knows better when it can take the request again than our backoff does.
+			if d := retryAfter(resp.Header, time.Now()); d > wait {
+				wait = d
+			}
+			resp.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentTypeJSON)
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req); err != nil {
+			return nil, err
+		}
+	}
+	return c.httpClient.Do(req)
+}
+
+func decodeResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if out == nil || resp.StatusCode == http.StatusNoContent {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(resp.Body)
+	var errResp ErrorResponse
+	if json.Unmarshal(data, &errResp) == nil {
+		apiErr.Message = errResp.Error
+	}
+	return apiErr
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// retryAfter returns the wait a Retry-After header asks for, given in seconds or as an HTTP date.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// backoff returns the full-jitter wait before the next attempt.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.baseBackoff << uint(attempt)
+	if d <= 0 || d > c.maxBackoff {
+		d = c.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
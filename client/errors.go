@@ -0,0 +1,49 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrNotFound     = errors.New("person not found")
+	ErrExists       = errors.New("person already exist")
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// ErrorResponse is the error payload returned by the service.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// APIError is returned for every non-successful response. It unwraps to one of
+// the Err* values when the status code has a well known meaning, so callers can
+// use errors.Is(err, client.ErrNotFound).
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("person service: %s", http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("person service: %s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusUnprocessableEntity:
+		return ErrExists
+	case http.StatusBadRequest:
+		return ErrBadRequest
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"PersonService/client"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewServer(NewInMemoryPersonStorage(), logBody))
+	defer server.Close()
+
+	ctx := context.Background()
+	c := client.New(server.URL, client.WithAuth(client.BasicAuth{Username: authLogin, Password: authPassword}))
+	joe := &client.Person{
+		ID:             uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"),
+		Name:           "Joe",
+		Communications: []*client.Communication{{Value: "box@mail.ua"}},
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		if _, err := c.Create(ctx, joe); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Create(ctx, joe); !errors.Is(err, client.ErrExists) {
+			t.Errorf("got %v, want ErrExists", err)
+		}
+
+		p, err := c.Get(ctx, joe.ID)
+		if err != nil || p.Name != "Joe" {
+			t.Errorf("got %v %v, want Joe", p, err)
+		}
+		if _, err := c.Get(ctx, uuid.NewV4()); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		pp, err := c.FindByCommunication(ctx, "box@mail.ua")
+		if err != nil || len(pp) != 1 {
+			t.Errorf("got %v %v, want Joe", pp, err)
+		}
+		pp, err = c.FindByName(ctx, "Louis")
+		if err != nil || len(pp) != 0 {
+			t.Errorf("got %v %v, want no persons", pp, err)
+		}
+	})
+
+	t.Run("list pages", func(t *testing.T) {
+		for i := 0; i < 4; i++ {
+			c.Create(ctx, &client.Person{ID: uuid.NewV4(), Name: "Louis"})
+		}
+
+		pages, total := 0, 0
+		it := c.List(ctx, 2)
+		for it.Next() {
+			pages++
+			total += len(it.Page())
+		}
+		if it.Err() != nil || pages != 3 || total != 5 {
+			t.Errorf("got %d pages with %d persons (%v), want 3 pages with 5 persons", pages, total, it.Err())
+		}
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		p, err := c.Update(ctx, &client.Person{ID: joe.ID, Name: "Joseph"})
+		if err != nil || p.Name != "Joseph" {
+			t.Errorf("got %v %v, want Joseph", p, err)
+		}
+		if err := c.Delete(ctx, joe.ID); err != nil {
+			t.Error(err)
+		}
+		if err := c.Delete(ctx, joe.ID); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		_, err := client.New(server.URL).Get(ctx, joe.ID)
+		if !errors.Is(err, client.ErrUnauthorized) {
+			t.Errorf("got %v, want ErrUnauthorized", err)
+		}
+	})
+}
+
+func TestClientRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		NewServer(NewInMemoryPersonStorage(), logBody).ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := client.New(server.URL,
+		client.WithAuth(client.BasicAuth{Username: authLogin, Password: authPassword}),
+		client.WithRetries(3, time.Millisecond, 10*time.Millisecond))
+
+	if _, err := c.Get(context.Background(), uuid.NewV4()); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound after retries", err)
+	}
+	if calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	if _, err := c.Create(context.Background(), &client.Person{ID: uuid.NewV4(), Name: "Joe"}); err == nil {
+		t.Errorf("create was retried")
+	}
+	if calls != 1 {
+		t.Errorf("got %d calls for create, want 1", calls)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"PersonService/client"
+
+	uuid "github.com/satori/go.uuid"
+	"gopkg.in/yaml.v3"
+)
+
+const pageSize = 100
+
+func (a *app) get(ctx context.Context, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+
+	p, err := a.client.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printPerson(a.out, a.output, p)
+}
+
+func (a *app) list(ctx context.Context, _ []string) error {
+	pp, err := a.all(ctx)
+	if err != nil {
+		return err
+	}
+	return printPersons(a.out, a.output, pp)
+}
+
+func (a *app) find(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	name := flags.String("name", "", "person name")
+	communication := flags.String("communication", "", "communication value")
+	flags.Parse(args)
+
+	var pp []*client.Person
+	var err error
+	switch {
+	case *name != "" && *communication != "":
+		pp, err = a.client.FindByName(ctx, *name)
+		pp = withCommunication(pp, *communication)
+	case *name != "":
+		pp, err = a.client.FindByName(ctx, *name)
+	case *communication != "":
+		pp, err = a.client.FindByCommunication(ctx, *communication)
+	default:
+		return errors.New("find needs --name or --communication")
+	}
+	if err != nil {
+		return err
+	}
+	return printPersons(a.out, a.output, pp)
+}
+
+func (a *app) create(ctx context.Context, args []string) error {
+	pp, err := readPersonsFlag("create", args)
+	if err != nil {
+		return err
+	}
+	if len(pp) != 1 {
+		return fmt.Errorf("create expects a single person, got %d", len(pp))
+	}
+
+	p := pp[0]
+	if uuid.Equal(p.ID, uuid.Nil) {
+		p.ID = uuid.NewV4()
+	}
+	created, err := a.client.Create(ctx, p)
+	if err != nil {
+		return err
+	}
+	return printPerson(a.out, a.output, created)
+}
+
+// edit opens the person as YAML in $EDITOR and saves it when the file was changed.
+func (a *app) edit(ctx context.Context, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	p, err := a.client.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	original, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "personctl-*.yaml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(original); err != nil {
+		return err
+	}
+	f.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// Through the shell, like git does, so EDITOR can carry arguments such as "code --wait".
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, original) {
+		fmt.Fprintln(os.Stderr, "personctl: no changes")
+		return nil
+	}
+
+	updated := &client.Person{}
+	if err := yaml.Unmarshal(edited, updated); err != nil {
+		return err
+	}
+	if !uuid.Equal(updated.ID, id) {
+		return errors.New("the id of a person can't be changed")
+	}
+	saved, err := a.client.Update(ctx, updated)
+	if err != nil {
+		return err
+	}
+	return printPerson(a.out, a.output, saved)
+}
+
+func (a *app) delete(ctx context.Context, args []string) error {
+	id, err := idArg(args)
+	if err != nil {
+		return err
+	}
+	return a.client.Delete(ctx, id)
+}
+
+func (a *app) importPersons(ctx context.Context, args []string) error {
+	pp, err := readPersonsFlag("import", args)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pp {
+		if _, err := a.client.Update(ctx, p); err != nil {
+			return fmt.Errorf("%s: %w", p.ID, err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "personctl: imported %d persons\n", len(pp))
+	return nil
+}
+
+func (a *app) exportPersons(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	file := flags.String("f", "-", "output file")
+	flags.Parse(args)
+
+	pp, err := a.all(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := a.out
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	format := a.output
+	if format == outputTable {
+		format = outputJSON
+	}
+	return printPersons(w, format, pp)
+}
+
+func (a *app) all(ctx context.Context) ([]*client.Person, error) {
+	pp := []*client.Person{}
+	it := a.client.List(ctx, pageSize)
+	for it.Next() {
+		pp = append(pp, it.Page()...)
+	}
+	return pp, it.Err()
+}
+
+func idArg(args []string) (uuid.UUID, error) {
+	if len(args) != 1 {
+		return uuid.Nil, errors.New("expected a person id")
+	}
+	return uuid.FromString(args[0])
+}
+
+func readPersonsFlag(name string, args []string) ([]*client.Person, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	file := flags.String("f", "", `JSON or YAML file, "-" for stdin`)
+	flags.Parse(args)
+
+	var data []byte
+	var err error
+	switch *file {
+	case "":
+		return nil, fmt.Errorf("%s needs -f", name)
+	case "-":
+		data, err = io.ReadAll(os.Stdin)
+	default:
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodePersons(data)
+}
+
+func withCommunication(pp []*client.Person, value string) []*client.Person {
+	res := []*client.Person{}
+	for _, p := range pp {
+		for _, comm := range p.Communications {
+			if comm.Value == value {
+				res = append(res, p)
+				break
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"PersonService/client"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// fakeService serves the parts of the person API personctl uses from a map.
+type fakeService struct {
+	mu      sync.Mutex
+	persons map[uuid.UUID]*client.Person
+}
+
+func newTestApp(t *testing.T) (*app, *fakeService, *bytes.Buffer) {
+	svc := &fakeService{persons: map[uuid.UUID]*client.Person{}}
+	srv := httptest.NewServer(svc)
+	t.Cleanup(srv.Close)
+	out := &bytes.Buffer{}
+	return &app{client: client.New(srv.URL), output: outputJSON, out: out}, svc, out
+}
+
+func (s *fakeService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if id := strings.TrimPrefix(r.URL.Path, "/person/"); id != r.URL.Path {
+		p, ok := s.persons[uuid.FromStringOrNil(id)]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.persons, p.ID)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost, http.MethodPut:
+		p := &client.Person{}
+		if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.persons[p.ID] = p
+		json.NewEncoder(w).Encode(p)
+	case http.MethodGet:
+		s.list(w, r)
+	}
+}
+
+// list pages through the persons in id order, like the real service.
+func (s *fakeService) list(w http.ResponseWriter, r *http.Request) {
+	pp := []*client.Person{}
+	for _, p := range s.persons {
+		if name := r.URL.Query().Get("name"); name == "" || p.Name == name {
+			pp = append(pp, p)
+		}
+	}
+	sort.Slice(pp, func(i, j int) bool { return pp[i].ID.String() < pp[j].ID.String() })
+	if after := r.URL.Query().Get("after"); after != "" {
+		i := sort.Search(len(pp), func(i int) bool { return pp[i].ID.String() > after })
+		pp = pp[i:]
+	}
+	if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && len(pp) > limit {
+		pp = pp[:limit]
+		w.Header().Set(nextCursorHeader, pp[limit-1].ID.String())
+	}
+	if len(pp) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(pp)
+}
+
+const nextCursorHeader = "X-Next-Cursor"
+
+func TestImportExport(t *testing.T) {
+	ctx := context.Background()
+	a, svc, out := newTestApp(t)
+	dir := t.TempDir()
+
+	// More than a page, so export has to follow the cursor.
+	var pp []*client.Person
+	for i := 0; i < pageSize+5; i++ {
+		pp = append(pp, &client.Person{ID: uuid.NewV4(), Name: "Person " + strconv.Itoa(i),
+			Communications: []*client.Communication{{Value: strconv.Itoa(i) + "@mail.ua"}}})
+	}
+	sort.Slice(pp, func(i, j int) bool { return pp[i].ID.String() < pp[j].ID.String() })
+	data, _ := json.Marshal(pp)
+	in := filepath.Join(dir, "in.json")
+	os.WriteFile(in, data, 0600)
+
+	if err := a.importPersons(ctx, []string{"-f", in}); err != nil {
+		t.Fatal(err)
+	}
+	if len(svc.persons) != len(pp) {
+		t.Fatalf("imported %d persons, want %d", len(svc.persons), len(pp))
+	}
+
+	exported := filepath.Join(dir, "out.json")
+	if err := a.exportPersons(ctx, []string{"-f", exported}); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(exported)
+	got, err := decodePersons(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, pp) {
+		t.Errorf("export doesn't match the import:\n%s", data)
+	}
+
+	t.Run("import replaces", func(t *testing.T) {
+		changed := *pp[0]
+		changed.Name = "Changed"
+		data, _ := json.Marshal(&changed)
+		os.WriteFile(in, data, 0600)
+		if err := a.importPersons(ctx, []string{"-f", in}); err != nil {
+			t.Fatal(err)
+		}
+		if svc.persons[changed.ID].Name != "Changed" || len(svc.persons) != len(pp) {
+			t.Errorf("got %+v", svc.persons[changed.ID])
+		}
+	})
+
+	t.Run("export to stdout", func(t *testing.T) {
+		out.Reset()
+		a.output = outputYAML
+		defer func() { a.output = outputJSON }()
+		if err := a.exportPersons(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+		got, err := decodePersons(out.Bytes())
+		if err != nil || len(got) != len(pp) {
+			t.Errorf("got %d persons, %v", len(got), err)
+		}
+	})
+}
+
+func TestCommands(t *testing.T) {
+	ctx := context.Background()
+	a, svc, out := newTestApp(t)
+	svc.persons[joe.ID] = joe
+	svc.persons[ann.ID] = ann
+
+	t.Run("get", func(t *testing.T) {
+		out.Reset()
+		if err := a.get(ctx, []string{joe.ID.String()}); err != nil {
+			t.Fatal(err)
+		}
+		got := &client.Person{}
+		if err := json.Unmarshal(out.Bytes(), got); err != nil || !reflect.DeepEqual(got, joe) {
+			t.Errorf("got %s, %v", out, err)
+		}
+		if err := a.get(ctx, []string{"123"}); err == nil {
+			t.Error("want an error for an invalid id")
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		out.Reset()
+		if err := a.find(ctx, []string{"--name", "Joe", "--communication", "box@mail.ua"}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := decodePersons(out.Bytes())
+		if len(got) != 1 || got[0].Name != "Joe" {
+			t.Errorf("got %s", out)
+		}
+	})
+
+	t.Run("edit", func(t *testing.T) {
+		// An editor with arguments, run non-interactively. The suffix keeps BSD sed happy, the
+		// backup lands in a directory the test removes.
+		t.Setenv("TMPDIR", t.TempDir())
+		t.Setenv("EDITOR", "sed -i.orig -e s/Ann/Anna/")
+		if err := a.edit(ctx, []string{ann.ID.String()}); err != nil {
+			t.Fatal(err)
+		}
+		if got := svc.persons[ann.ID].Name; got != "Anna" {
+			t.Errorf("name = %q, want Anna", got)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := a.delete(ctx, []string{joe.ID.String()}); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := svc.persons[joe.ID]; ok {
+			t.Error("joe is still there")
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is read from ~/.config/personctl/config.yaml:
+//
+//	current: local
+//	profiles:
+//	  local:
+//	    endpoint: http://localhost:5002
+//	    username: admin
+//	    password: admin
+type Config struct {
+	Current  string              `yaml:"current"`
+	Profiles map[string]*Profile `yaml:"profiles"`
+}
+
+type Profile struct {
+	Endpoint string `yaml:"endpoint"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+var defaultProfile = &Profile{
+	Endpoint: "http://localhost:5002",
+	Username: "admin",
+	Password: "admin",
+}
+
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "personctl.yaml"
+	}
+	return filepath.Join(dir, "personctl", "config.yaml")
+}
+
+// loadProfile returns the named profile, the current one when name is empty,
+// or the local defaults when there is no config file.
+func loadProfile(path, name string) (*Profile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && name == "" {
+		return defaultProfile, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if name == "" {
+		name = cfg.Current
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: profile %q not found", path, name)
+	}
+	return profile, nil
+}
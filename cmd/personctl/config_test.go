@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	config := `current: local
+profiles:
+  local:
+    endpoint: http://localhost:5002
+    username: admin
+    password: admin
+  prod:
+    endpoint: https://persons.example.com
+    username: ops
+    password: secret
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, name string
+		want       string
+		wantErr    bool
+	}{
+		{path, "", "http://localhost:5002", false},
+		{path, "prod", "https://persons.example.com", false},
+		{path, "staging", "", true},
+		{filepath.Join(dir, "missing.yaml"), "", defaultProfile.Endpoint, false},
+		{filepath.Join(dir, "missing.yaml"), "prod", "", true},
+	}
+	for _, tt := range tests {
+		profile, err := loadProfile(tt.path, tt.name)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("loadProfile(%s, %q) = %+v, want an error", filepath.Base(tt.path), tt.name, profile)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("loadProfile(%s, %q): %v", filepath.Base(tt.path), tt.name, err)
+		} else if profile.Endpoint != tt.want {
+			t.Errorf("loadProfile(%s, %q) endpoint = %q, want %q", filepath.Base(tt.path), tt.name, profile.Endpoint, tt.want)
+		}
+	}
+
+	t.Run("invalid yaml", func(t *testing.T) {
+		broken := filepath.Join(dir, "broken.yaml")
+		os.WriteFile(broken, []byte("profiles: ["), 0600)
+		if _, err := loadProfile(broken, ""); err == nil {
+			t.Error("want an error")
+		}
+	})
+}
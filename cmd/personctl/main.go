@@ -0,0 +1,82 @@
+// Command personctl manages persons through the person service HTTP API.
+//
+//	personctl [-profile name] [-config path] [-o table|json|yaml] <command> [args]
+//
+// Commands:
+//
+//	get <id>                             show a person
+//	list                                 list all persons
+//	find --name <n> --communication <c>  search persons
+//	create -f person.json                add a person (JSON or YAML, "-" for stdin)
+//	edit <id>                            edit a person in $EDITOR and save it
+//	delete <id>                          delete a person
+//	import -f persons.json               add or replace a list of persons
+//	export [-f persons.json]             write all persons to a file or stdout
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"PersonService/client"
+)
+
+type app struct {
+	client *client.Client
+	output string
+	out    io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("personctl", flag.ExitOnError)
+	configPath := flags.String("config", defaultConfigPath(), "config file")
+	profileName := flags.String("profile", os.Getenv("PERSONCTL_PROFILE"), "config profile, defaults to the current one")
+	output := flags.String("o", outputTable, "output format: table, json or yaml")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: personctl [flags] get|list|find|create|edit|delete|import|export [args]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	profile, err := loadProfile(*configPath, *profileName)
+	if err != nil {
+		fatal(err)
+	}
+	a := &app{
+		client: client.New(profile.Endpoint,
+			client.WithAuth(client.BasicAuth{Username: profile.Username, Password: profile.Password})),
+		output: *output,
+		out:    os.Stdout,
+	}
+
+	commands := map[string]func(context.Context, []string) error{
+		"get":    a.get,
+		"list":   a.list,
+		"find":   a.find,
+		"create": a.create,
+		"edit":   a.edit,
+		"delete": a.delete,
+		"import": a.importPersons,
+		"export": a.exportPersons,
+	}
+	command, ok := commands[flags.Arg(0)]
+	if !ok {
+		fatal(fmt.Errorf("unknown command %q", flags.Arg(0)))
+	}
+	if err := command(context.Background(), flags.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "personctl:", err)
+	os.Exit(1)
+}
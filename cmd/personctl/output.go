@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"PersonService/client"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+func printPersons(w io.Writer, format string, pp []*client.Person) error {
+	switch format {
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tCOMMUNICATIONS")
+		for _, p := range pp {
+			values := make([]string, 0, len(p.Communications))
+			for _, comm := range p.Communications {
+				values = append(values, comm.Value)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.ID, p.Name, strings.Join(values, ", "))
+		}
+		return tw.Flush()
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pp)
+	case outputYAML:
+		return yaml.NewEncoder(w).Encode(pp)
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func printPerson(w io.Writer, format string, p *client.Person) error {
+	switch format {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	case outputYAML:
+		return yaml.NewEncoder(w).Encode(p)
+	default:
+		return printPersons(w, format, []*client.Person{p})
+	}
+}
+
+// decodePersons accepts a single person or a list, as JSON or YAML.
+func decodePersons(data []byte) ([]*client.Person, error) {
+	var pp []*client.Person
+	if err := yaml.Unmarshal(data, &pp); err == nil {
+		return pp, nil
+	}
+
+	p := &client.Person{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return []*client.Person{p}, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"PersonService/client"
+
+	uuid "github.com/satori/go.uuid"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	joe = &client.Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"), Name: "Joe",
+		Communications: []*client.Communication{{Value: "box@mail.ua"}, {Value: "+380973224562"}}}
+	ann = &client.Person{ID: uuid.FromStringOrNil("7c8d5c2a-4bd5-4c7e-9a4b-3f54f0c1d2e3"), Name: "Ann",
+		Communications: []*client.Communication{}}
+)
+
+func TestDecodePersons(t *testing.T) {
+	tests := []struct {
+		name, data string
+		want       []*client.Person
+	}{
+		{"json person", `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe",
+			"communications": [{"value": "box@mail.ua"}, {"value": "+380973224562"}]}`, []*client.Person{joe}},
+		{"json list", `[{"id": "7c8d5c2a-4bd5-4c7e-9a4b-3f54f0c1d2e3", "name": "Ann", "communications": []}]`, []*client.Person{ann}},
+		{"yaml person", "id: 02a883a3-13c4-4624-bbba-edc744f69534\nname: Joe\ncommunications:\n  - value: box@mail.ua\n  - value: \"+380973224562\"\n",
+			[]*client.Person{joe}},
+		{"yaml list", "- id: 7c8d5c2a-4bd5-4c7e-9a4b-3f54f0c1d2e3\n  name: Ann\n  communications: []\n", []*client.Person{ann}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePersons([]byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := decodePersons([]byte("name: [")); err == nil {
+		t.Error("want an error for invalid input")
+	}
+}
+
+func TestPrintPersons(t *testing.T) {
+	pp := []*client.Person{joe, ann}
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printPersons(&buf, outputTable, pp); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") {
+			t.Fatalf("got\n%s", buf.String())
+		}
+		if !strings.Contains(lines[1], "Joe") || !strings.HasSuffix(lines[1], "box@mail.ua, +380973224562") {
+			t.Errorf("row = %q", lines[1])
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printPersons(&buf, outputJSON, pp); err != nil {
+			t.Fatal(err)
+		}
+		var got []*client.Person
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil || !reflect.DeepEqual(got, pp) {
+			t.Errorf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := printPerson(&buf, outputYAML, joe); err != nil {
+			t.Fatal(err)
+		}
+		got := &client.Person{}
+		if err := yaml.Unmarshal(buf.Bytes(), got); err != nil || !reflect.DeepEqual(got, joe) {
+			t.Errorf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if err := printPersons(&bytes.Buffer{}, "xml", pp); err == nil {
+			t.Error("want an error")
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-http-utils/headers"
+	"github.com/munnerz/goautoneg"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Codec reads and writes one representation of the API resources. MediaTypes
+// lists the types it is known by, preferred first. Decode is strict: it rejects
+// fields the value doesn't have where the format can tell, and anything after the first value.
+type Codec interface {
+	MediaTypes() []string
+	Encode(w io.Writer, v interface{}) error
+	Decode(data []byte, v interface{}) error
+}
+
+// CodecRegistry maps media types to codecs. The first registered codec is
+// used when the client doesn't say what it accepts.
+type CodecRegistry struct {
+	byType     map[string]Codec
+	mediaTypes []string
+}
+
+var codecs = NewCodecRegistry(
+	jsonCodec{},
+	xmlCodec{},
+	yamlCodec{},
+	msgpackCodec{},
+)
+
+func NewCodecRegistry(cc ...Codec) *CodecRegistry {
+	r := &CodecRegistry{byType: make(map[string]Codec)}
+	for _, c := range cc {
+		r.Register(c)
+	}
+	return r
+}
+
+func (r *CodecRegistry) Register(c Codec) {
+	for _, t := range c.MediaTypes() {
+		r.byType[t] = c
+		r.mediaTypes = append(r.mediaTypes, t)
+	}
+}
+
+// ForContentType returns the codec for a Content-Type header value; parameters such as charset are ignored.
+func (r *CodecRegistry) ForContentType(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	c, ok := r.byType[mediaType]
+	return c, ok
+}
+
+// Negotiate picks the media type of the response from an Accept header. It
+// returns false when none of the registered types is acceptable.
+func (r *CodecRegistry) Negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return r.mediaTypes[0], true
+	}
+
+	clauses := goautoneg.ParseAccept(strings.ToLower(accept))
+	refused := make(map[string]bool)
+	for _, c := range clauses {
+		if c.Q <= 0 {
+			refused[c.Type+"/"+c.SubType] = true
+		}
+	}
+	for _, c := range clauses {
+		if c.Q <= 0 {
+			continue
+		}
+		for _, t := range r.mediaTypes {
+			typ, subType, _ := strings.Cut(t, "/")
+			if refused[t] || (c.Type != "*" && c.Type != typ) || (c.SubType != "*" && c.SubType != subType) {
+				continue
+			}
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// negotiate sets the response Content-Type from the Accept header so that
+// encodeBody and handleError write the representation the client asked for.
+func negotiate(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add(headers.Vary, headers.Accept)
+	mediaType, ok := codecs.Negotiate(r.Header.Get(headers.Accept))
+	if !ok {
+		w.Header().Set(headers.ContentType, contentTypeJSON)
+		handleError(notAcceptableError, w, http.StatusNotAcceptable)
+		return false
+	}
+	w.Header().Set(headers.ContentType, mediaType)
+	return true
+}
+
+// encodeBody writes v in the representation named by the response Content-Type, JSON by default.
+func encodeBody(w http.ResponseWriter, v interface{}) error {
+	c, ok := codecs.ForContentType(w.Header().Get(headers.ContentType))
+	if !ok {
+		c = jsonCodec{}
+	}
+	return c.Encode(w, v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaTypes() []string { return []string{contentTypeJSON} }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(data []byte, v interface{}) error {
+	if !utf8.Valid(data) {
+		return invalidUTF8Error
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return describeJSONError(err)
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return multipleJSONValuesError
+	}
+	return nil
+}
+
+// xmlCodec can't reject unknown elements: encoding/xml skips them.
+type xmlCodec struct{}
+
+func (xmlCodec) MediaTypes() []string { return []string{contentTypeXML, "text/xml"} }
+
+// Encode wraps slices in a list element so the output has a single root.
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(w)
+	if reflect.ValueOf(v).Kind() == reflect.Slice {
+		v = xmlList{Items: v}
+	}
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (xmlCodec) Decode(data []byte, v interface{}) error {
+	if !utf8.Valid(data) {
+		return invalidUTF8Error
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", malformedBodyError, err)
+	}
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", malformedBodyError, err)
+		}
+		switch tok := tok.(type) {
+		case xml.Comment, xml.ProcInst:
+		case xml.CharData:
+			if len(bytes.TrimSpace(tok)) != 0 {
+				return multipleValuesError
+			}
+		default:
+			return multipleValuesError
+		}
+	}
+}
+
+type xmlList struct {
+	XMLName xml.Name `xml:"list"`
+	Items   interface{}
+}
+
+type yamlCodec struct{}
+
+func (yamlCodec) MediaTypes() []string {
+	return []string{contentTypeYAML, "application/x-yaml", "text/yaml"}
+}
+
+func (yamlCodec) Encode(w io.Writer, v interface{}) error {
+	e := yaml.NewEncoder(w)
+	if err := e.Encode(v); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+func (yamlCodec) Decode(data []byte, v interface{}) error {
+	if !utf8.Valid(data) {
+		return invalidUTF8Error
+	}
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(v); err != nil {
+		return describeYAMLError(err)
+	}
+	var extra interface{}
+	if err := d.Decode(&extra); err != io.EOF {
+		return multipleValuesError
+	}
+	return nil
+}
+
+// describeYAMLError names the first unknown field; yaml.v3 reports them as
+// "line 1: field comunications not found in type main.Person".
+func describeYAMLError(err error) error {
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, msg := range typeErr.Errors {
+			_, rest, _ := strings.Cut(msg, ": ")
+			var field string
+			if _, scanErr := fmt.Sscanf(rest, "field %s not found", &field); scanErr == nil {
+				return fmt.Errorf("%w %q", unknownFieldError, field)
+			}
+		}
+	}
+	return fmt.Errorf("%w: %v", malformedBodyError, err)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaTypes() []string {
+	return []string{contentTypeMsgpack, "application/x-msgpack", "application/vnd.msgpack"}
+}
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	return msgpack.NewEncoder(w).Encode(v)
+}
+
+func (msgpackCodec) Decode(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	d := msgpack.NewDecoder(r)
+	d.DisallowUnknownFields(true)
+	if err := d.Decode(v); err != nil {
+		var field string
+		if _, scanErr := fmt.Sscanf(err.Error(), "msgpack: unknown field %q", &field); scanErr == nil {
+			return fmt.Errorf("%w %q", unknownFieldError, field)
+		}
+		return fmt.Errorf("%w: %v", malformedBodyError, err)
+	}
+	if r.Len() != 0 {
+		return multipleValuesError
+	}
+	return nil
+}
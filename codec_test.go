@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	person := &Person{
+		ID:   uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"),
+		Name: "Joe",
+		Communications: []*Communication{
+			{Value: "box@mail.ua"},
+			{Value: "+380973224562"},
+		},
+	}
+
+	for _, codec := range []Codec{jsonCodec{}, xmlCodec{}, yamlCodec{}, msgpackCodec{}} {
+		t.Run(codec.MediaTypes()[0], func(t *testing.T) {
+			for _, v := range []interface{}{person, &Communication{Value: "box@mail.ua"}, &ErrorResponse{Error: "person not found"}} {
+				buf := &bytes.Buffer{}
+				if err := codec.Encode(buf, v); err != nil {
+					t.Fatalf("encode %T: %v", v, err)
+				}
+				got := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+				if err := codec.Decode(buf.Bytes(), got); err != nil {
+					t.Fatalf("decode %T: %v\n%s", v, err, buf)
+				}
+				// XMLName is only filled in by the XML decoder.
+				if p, ok := got.(*Person); ok {
+					p.XMLName = person.XMLName
+				}
+				if e, ok := got.(*ErrorResponse); ok {
+					e.XMLName = v.(*ErrorResponse).XMLName
+				}
+				if !reflect.DeepEqual(got, v) {
+					t.Errorf("got %+v, want %+v", got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept, want string
+		ok           bool
+	}{
+		{"", contentTypeJSON, true},
+		{"*/*", contentTypeJSON, true},
+		{"application/xml", contentTypeXML, true},
+		{"text/xml", "text/xml", true},
+		{"Application/YAML", contentTypeYAML, true},
+		{"text/html, application/msgpack;q=0.5", contentTypeMsgpack, true},
+		{"application/json;q=0.1, application/yaml", contentTypeYAML, true},
+		{"application/json;q=0, application/*", contentTypeXML, true},
+		{"text/*", "text/xml", true},
+		{"text/html", "", false},
+		{"application/json;q=0", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := codecs.Negotiate(tt.accept)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Negotiate(%q) = %q, %v, want %q, %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	server := NewServer(NewInMemoryPersonStorage(), logBody)
+	do := func(method, path, contentType, accept, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("add person in XML", func(t *testing.T) {
+		response := do("POST", "/person", contentTypeXML+"; charset=utf-8", contentTypeXML,
+			`<person>
+				<id>02a883a3-13c4-4624-bbba-edc744f69534</id>
+				<name>Joe</name>
+				<communications>
+					<communication><value>box@mail.ua</value></communication>
+				</communications>
+			</person>`)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		if got := response.Header().Get("Content-Type"); got != contentTypeXML {
+			t.Errorf("Content-Type = %q, want %q", got, contentTypeXML)
+		}
+		if !strings.Contains(response.Body.String(), "<person><id>02a883a3-13c4-4624-bbba-edc744f69534</id><name>Joe</name>") {
+			t.Errorf("unexpected body %s", response.Body)
+		}
+	})
+
+	t.Run("list persons in XML", func(t *testing.T) {
+		response := do("GET", "/person", "", "text/xml", "")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if !strings.Contains(response.Body.String(), "<list><person>") {
+			t.Errorf("unexpected body %s", response.Body)
+		}
+	})
+
+	t.Run("get person in YAML", func(t *testing.T) {
+		response := do("GET", "/person/02a883a3-13c4-4624-bbba-edc744f69534", "", contentTypeYAML, "")
+
+		assertStatus(t, response.Code, http.StatusOK)
+		want := "id: 02a883a3-13c4-4624-bbba-edc744f69534\nname: Joe\ncommunications:\n    - value: box@mail.ua\n"
+		if response.Body.String() != want {
+			t.Errorf("got %q, want %q", response.Body, want)
+		}
+	})
+
+	t.Run("put person in MessagePack", func(t *testing.T) {
+		body, _ := msgpack.Marshal(&Person{
+			ID:   uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"),
+			Name: "Joseph",
+		})
+		response := do("PUT", "/person", contentTypeMsgpack, contentTypeMsgpack, string(body))
+
+		assertStatus(t, response.Code, http.StatusOK)
+		got := &Person{}
+		if err := msgpack.Unmarshal(response.Body.Bytes(), got); err != nil || got.Name != "Joseph" {
+			t.Errorf("got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("unknown YAML field", func(t *testing.T) {
+		response := do("PUT", "/person", contentTypeYAML, contentTypeYAML,
+			"id: 02a883a3-13c4-4624-bbba-edc744f69534\nname: Joe\ncomunications: []\n")
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+		if want := "error: unknown field \"comunications\"\n"; response.Body.String() != want {
+			t.Errorf("got %q, want %q", response.Body, want)
+		}
+	})
+
+	t.Run("error in XML", func(t *testing.T) {
+		response := do("GET", "/person/6f4b6a35-0b0c-4d4e-9b55-ea4ae1cdb4a1", "", contentTypeXML, "")
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		if !strings.Contains(response.Body.String(), "<error>person not found</error>") {
+			t.Errorf("unexpected body %s", response.Body)
+		}
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		response := do("GET", "/person", "", "text/html", "")
+
+		assertStatus(t, response.Code, http.StatusNotAcceptable)
+		if got := response.Header().Get("Content-Type"); got != contentTypeJSON {
+			t.Errorf("Content-Type = %q, want %q", got, contentTypeJSON)
+		}
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		response := do("POST", "/person", "text/csv", "", "id,name")
+
+		assertStatus(t, response.Code, http.StatusUnsupportedMediaType)
+	})
+}
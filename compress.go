@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-http-utils/headers"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor is what the gzip, zlib, brotli and zstd writers have in common.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// contentEncodings lists the response encodings in the order they are preferred
+// when the client accepts several equally.
+var contentEncodings = []string{"zstd", "br", "gzip", "deflate"}
+
+var compressors = map[string]*sync.Pool{
+	"zstd": {New: func() interface{} {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+	"br":      {New: func() interface{} { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }},
+	"gzip":    {New: func() interface{} { return gzip.NewWriter(nil) }},
+	"deflate": {New: func() interface{} { return zlib.NewWriter(nil) }},
+}
+
+// WithCompression sets the smallest response body that is compressed. A negative size turns compression off.
+func WithCompression(minSize int) ServerOption {
+	return func(s *Server) {
+		s.compressionMinSize = minSize
+	}
+}
+
+// compression decodes gzip request bodies and compresses responses in the best
+// encoding the client accepts. It sits outside logging, so the access log and
+// the body size limit both see the uncompressed bytes.
+func (s *Server) compression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.decompressBody(w, r); err != nil {
+			w.Header().Set(headers.ContentType, contentTypeJSON)
+			status := http.StatusBadRequest
+			if err == unsupportedContentEncodingError {
+				status = http.StatusUnsupportedMediaType
+			}
+			handleError(err, w, status)
+			return
+		}
+
+		if s.compressionMinSize < 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add(headers.Vary, headers.AcceptEncoding)
+		encoding := negotiateEncoding(r.Header.Get(headers.AcceptEncoding))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{ResponseWriter: w, encoding: encoding, minSize: s.compressionMinSize}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// decompressBody replaces a gzip body with its uncompressed content. The result is
+// limited to the body size limit, so a small bomb can't expand without bounds.
+func (s *Server) decompressBody(w http.ResponseWriter, r *http.Request) error {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get(headers.ContentEncoding))) {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+	default:
+		return unsupportedContentEncodingError
+	}
+
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		return fmt.Errorf("%w: %v", malformedBodyError, err)
+	}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{http.MaxBytesReader(w, gz, s.maxBodySize), r.Body}
+	r.Header.Del(headers.ContentEncoding)
+	r.Header.Del(headers.ContentLength)
+	r.ContentLength = -1
+	return nil
+}
+
+// negotiateEncoding returns the accepted encoding with the highest q-value, or "" for identity.
+func negotiateEncoding(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	q := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+
+	best, bestQ := "", 0.0
+	for _, enc := range contentEncodings {
+		weight, ok := q[enc]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > bestQ {
+			best, bestQ = enc, weight
+		}
+	}
+	return best
+}
+
+// compressResponseWriter holds the body back until minSize bytes are written, a
+// flush is requested or the handler returns, and then decides whether to compress.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	statusCode  int
+	buf         []byte
+	decided     bool
+	compressor  compressor
+	wroteHeader bool
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.statusCode = code
+	if !bodyAllowed(code) {
+		cw.start(false)
+	}
+}
+
+func (cw *compressResponseWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minSize {
+			return len(b), nil
+		}
+		return len(b), cw.start(true)
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// start sends the header, with Content-Encoding when compress is set and the
+// content type is worth compressing, and then the buffered body.
+func (cw *compressResponseWriter) start(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if compress && h.Get(headers.ContentEncoding) == "" && compressible(h.Get(headers.ContentType)) {
+		h.Set(headers.ContentEncoding, cw.encoding)
+		h.Del(headers.ContentLength)
+		cw.compressor = compressors[cw.encoding].Get().(compressor)
+		cw.compressor.Reset(cw.ResponseWriter)
+	}
+	if cw.statusCode == 0 {
+		cw.statusCode = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush commits to compression, since a streaming response is rarely short,
+// and pushes out what has been compressed so far.
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.start(true)
+	}
+	if cw.compressor != nil {
+		cw.compressor.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Close finishes the response once the handler has returned.
+func (cw *compressResponseWriter) Close() error {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			return nil
+		}
+		if err := cw.start(false); err != nil {
+			return err
+		}
+	}
+	if cw.compressor == nil {
+		return nil
+	}
+	err := cw.compressor.Close()
+	cw.compressor.Reset(nil)
+	compressors[cw.encoding].Put(cw.compressor)
+	cw.compressor = nil
+	return err
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the write deadline.
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func bodyAllowed(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressible tells text formats, which shrink well, from already compressed or binary ones.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case contentTypeJSON, contentTypeXML, contentTypeYAML, "application/x-yaml", contentTypeMsgpack, "application/javascript":
+		return true
+	}
+	return false
+}
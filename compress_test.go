@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct{ acceptEncoding, want string }{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"GZIP;q=0.5, deflate;q=0.8", "deflate"},
+		{"*", "zstd"},
+		{"*;q=0.5, gzip", "gzip"},
+		{"gzip;q=0", ""},
+		{"compress", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.acceptEncoding); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+		}
+	}
+}
+
+func TestResponseCompression(t *testing.T) {
+	storage := NewInMemoryPersonStorage()
+	for i := 0; i < 50; i++ {
+		storage.Add(&Person{ID: uuid.NewV4(), Name: fmt.Sprintf("Person %d", i)})
+	}
+	joe, _ := storage.Add(&Person{ID: uuid.NewV4(), Name: "Joe"})
+	server := NewServer(storage, logBody)
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"deflate": func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+		"br":      func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd":    func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		t.Run(encoding, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/person", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			setRequestAuth(req)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, req)
+
+			assertStatus(t, response.Code, http.StatusOK)
+			if got := response.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if !strings.Contains(response.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q", response.Header().Get("Vary"))
+			}
+			r, err := decode(response.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var pp []*Person
+			if err := json.NewDecoder(r).Decode(&pp); err != nil || len(pp) != 51 {
+				t.Errorf("got %d persons, %v", len(pp), err)
+			}
+		})
+	}
+
+	t.Run("below the threshold", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/person/"+joe.ID.String(), nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusOK)
+		if got := response.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Content-Encoding = %q, want none", got)
+		}
+		if !strings.Contains(response.Body.String(), `"name":"Joe"`) {
+			t.Errorf("unexpected body %s", response.Body)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		server := NewServer(storage, logBody, WithCompression(-1))
+		req, _ := http.NewRequest("GET", "/person", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		if got := response.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Content-Encoding = %q, want none", got)
+		}
+	})
+}
+
+func TestCompressedRequestBody(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewServer(NewInMemoryPersonStorage(), true, WithMaxBodySize(1024), WithLogger(zerolog.New(&logs)))
+	gzipped := func(s string) io.Reader {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(s))
+		gz.Close()
+		return &buf
+	}
+	post := func(encoding string, body io.Reader) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/person", body)
+		req.Header.Set("Content-Type", contentTypeJSON)
+		req.Header.Set("Content-Encoding", encoding)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("gzip", func(t *testing.T) {
+		response := post("gzip", gzipped(`{"id":"02a883a3-13c4-4624-bbba-edc744f69534","name":"Joe","communications":[]}`))
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		entry := lastLogEntry(t, &logs)
+		if body, _ := entry["request_body"].(string); !strings.Contains(body, `"id":"02a883a3-13c4-4624-bbba-edc744f69534"`) {
+			t.Errorf("request body is not logged uncompressed: %v", entry)
+		}
+	})
+
+	t.Run("decompression bomb", func(t *testing.T) {
+		response := post("gzip", gzipped(`{"name":"`+strings.Repeat("a", 1<<20)+`"}`))
+
+		assertStatus(t, response.Code, http.StatusRequestEntityTooLarge)
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		response := post("gzip", strings.NewReader(`{"name":"Joe"}`))
+
+		assertStatus(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		response := post("compress", strings.NewReader(`{"name":"Joe"}`))
+
+		assertStatus(t, response.Code, http.StatusUnsupportedMediaType)
+	})
+}
+
+func TestCompressedEventStream(t *testing.T) {
+	bus := NewEventBus(eventBufferSize)
+	storage := NewEventStorage(NewInMemoryPersonStorage(), bus.Publish)
+	server := httptest.NewServer(NewServer(storage, logBody, WithEventBus(bus)))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/person/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	setRequestAuth(req)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+
+	// Each event is flushed through the compressor, so it arrives while the stream is open.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		storage.Add(&Person{ID: uuid.NewV4(), Name: "Joe"})
+	}()
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(gz)
+	for scanner.Scan() {
+		if scanner.Text() == "event: created" {
+			return
+		}
+	}
+	t.Fatalf("no event received: %v", scanner.Err())
+}
@@ -1,7 +1,136 @@
 package main
 
+import "time"
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeXML     = "application/xml"
+	contentTypeYAML    = "application/yaml"
+	contentTypeMsgpack = "application/msgpack"
+	authLogin          = "admin"
+	authPassword       = "admin"
+
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookDeliveryHeader  = "X-Webhook-Delivery"
+	webhookSignatureHeader = "X-Webhook-Signature"
+	webhookTimeout         = 10 * time.Second
+	webhookMaxAttempts     = 8
+	webhookBaseBackoff     = time.Second
+	webhookMaxBackoff      = 10 * time.Minute
+	webhookPollInterval    = time.Second
+	webhookWorkers         = 8
+)
+
+const (
+	eventBufferSize        = 1000
+	eventSubscriberBuffer  = 64
+	eventHeartbeatInterval = 15 * time.Second
+	postgresEventsChannel  = "person_events"
+	pgNotifyMaxPayload     = 8000
+)
+
+const (
+	walSyncAlways           = "always"
+	walSyncInterval         = "interval"
+	walSyncNever            = "never"
+	defaultWALSyncInterval  = time.Second
+	defaultSnapshotInterval = 5 * time.Minute
+)
+
+const (
+	defaultSQLitePath = "persons.db"
+	sqliteBusyTimeout = 5 * time.Second
+	// sqliteMaxVariables is SQLITE_MAX_VARIABLE_NUMBER of the bundled SQLite.
+	sqliteMaxVariables = 32766
+	defaultBoltPath    = "persons.bolt"
+	boltOpenTimeout    = time.Second
+	boltMaxIndexValue  = 1024
+)
+
+const (
+	outboxChannel      = "person_outbox"
+	outboxLockID       = 7310425
+	outboxBatchSize    = 100
+	outboxPollInterval = 5 * time.Second
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	requestIDMaxLength = 128
+
+	defaultLogFile       = "logs/person_server.log"
+	defaultLogMaxSize    = 100 << 20
+	defaultLogMaxAge     = 24 * time.Hour
+	defaultLogMaxBackups = 7
+)
+
+const (
+	defaultRedactFields = "name,communications[].value,secret,query"
+	defaultLogBodyMax   = 4096
+	logBodyCaptureLimit = 1 << 20
+	redactMask          = "***"
+	redactedBodyMarker  = "[%d bytes not logged]"
+	truncatedBodyMarker = "...[truncated %d bytes]"
+	logRedactKeyEnv     = "PERSON_SERVICE_LOG_REDACT_KEY"
+)
+
+const (
+	metricsNamespace   = "person_service"
+	personCountTimeout = 2 * time.Second
+)
+
+const (
+	tracerName       = "PersonService"
+	defaultTraceFile = "traces.json"
+)
+
+const (
+	healthCheckTimeout   = 2 * time.Second
+	healthStatusOK       = "ok"
+	healthStatusFail     = "fail"
+	healthStatusDraining = "draining"
+	shutdownDrainDelay   = 5 * time.Second
+	shutdownTimeout      = 30 * time.Second
+)
+
+const (
+	serverReadHeaderTimeout   = 5 * time.Second
+	serverReadTimeout         = 30 * time.Second
+	serverWriteTimeout        = 60 * time.Second
+	serverIdleTimeout         = 2 * time.Minute
+	defaultMaxBodySize        = 1 << 20
+	defaultCompressionMinSize = 1024
+)
+
+const corsMaxAge = 10 * time.Minute
+
+const (
+	storageTimeout          = 5 * time.Second
+	storageMaxAttempts      = 3
+	storageBaseBackoff      = 50 * time.Millisecond
+	storageMaxBackoff       = time.Second
+	breakerFailureThreshold = 5
+	breakerOpenTimeout      = 30 * time.Second
+)
+
+const (
+	defaultCacheTTL         = time.Minute
+	defaultCacheNegativeTTL = 5 * time.Second
+)
+
+const (
+	tlsReloadInterval     = 10 * time.Second
+	tlsClientAuthRequire  = "require"
+	tlsClientAuthOptional = "optional"
+)
+
 const (
-	contentTypeJSON = "application/json"
-	authLogin       = "admin"
-	authPassword    = "admin"
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+	rateLimitMaxBuckets      = 10000
 )
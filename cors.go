@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-http-utils/headers"
+)
+
+// CORSConfig lists who may call the API from a browser. An origin may be "*"
+// or have a wildcard host such as "https://*.example.com".
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{headers.Authorization, headers.ContentType, headers.ContentEncoding, requestIDHeader, "Last-Event-ID"},
+		ExposedHeaders: []string{
+			headers.ETag, headers.Location, headers.RetryAfter, nextCursorHeader, requestIDHeader,
+			rateLimitLimitHeader, rateLimitRemainingHeader, rateLimitResetHeader,
+		},
+		MaxAge: corsMaxAge,
+	}
+}
+
+type CORS struct {
+	origins          []string
+	anyOrigin        bool
+	allowCredentials bool
+	allowMethods     string
+	allowHeaders     string
+	exposeHeaders    string
+	maxAge           string
+}
+
+func NewCORS(cfg CORSConfig) (*CORS, error) {
+	c := &CORS{
+		allowCredentials: cfg.AllowCredentials,
+		allowMethods:     strings.Join(cfg.AllowedMethods, ", "),
+		allowHeaders:     strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders:    strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:           strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch origin {
+		case "":
+		case "*":
+			c.anyOrigin = true
+		default:
+			c.origins = append(c.origins, origin)
+		}
+	}
+	if c.anyOrigin && c.allowCredentials {
+		// Browsers refuse "*" with credentials, and echoing any origin would let every site act as the user.
+		return nil, errors.New("credentialed CORS requests need an explicit origin list")
+	}
+	return c, nil
+}
+
+// WithCORS lets browsers on the allowed origins call the API. Without it no CORS headers are sent.
+func WithCORS(c *CORS) ServerOption {
+	return func(s *Server) {
+		s.corsPolicy = c
+	}
+}
+
+func (c *CORS) allowed(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		if allowed == origin {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(allowed, "*"); ok &&
+			len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// cors answers preflight requests itself, before they reach rate limiting and
+// authentication, and adds the CORS headers to every response for an allowed origin.
+func (s *Server) cors(next http.Handler) http.Handler {
+	c := s.corsPolicy
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get(headers.Origin)
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add(headers.Vary, headers.Origin)
+		allowed := c.allowed(origin)
+		if allowed {
+			if c.anyOrigin {
+				h.Set(headers.AccessControlAllowOrigin, "*")
+			} else {
+				h.Set(headers.AccessControlAllowOrigin, origin)
+			}
+			if c.allowCredentials {
+				h.Set(headers.AccessControlAllowCredentials, "true")
+			}
+		}
+
+		if r.Method != http.MethodOptions || r.Header.Get(headers.AccessControlRequestMethod) == "" {
+			if allowed && c.exposeHeaders != "" {
+				h.Set(headers.AccessControlExposeHeaders, c.exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// A preflight. The browser checks the answer, so a disallowed origin just gets no CORS headers.
+		h.Add(headers.Vary, headers.AccessControlRequestMethod)
+		h.Add(headers.Vary, headers.AccessControlRequestHeaders)
+		if allowed {
+			h.Set(headers.AccessControlAllowMethods, c.allowMethods)
+			h.Set(headers.AccessControlAllowHeaders, c.allowHeaders)
+			h.Set(headers.AccessControlMaxAge, c.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
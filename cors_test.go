@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := DefaultCORSConfig()
+	cfg.AllowedOrigins = []string{"https://dashboard.example.org", "https://*.preview.example.org"}
+	cfg.AllowCredentials = true
+	cors, err := NewCORS(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(NewInMemoryPersonStorage(), logBody, WithCORS(cors),
+		WithRateLimiter(NewMemoryRateLimiter(), RateLimitConfig{Anonymous: RateLimit{Rate: 1, Burst: 1}}))
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(http.MethodOptions, "/person", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		// More preflights than the anonymous rate limit allows; none of them needs credentials.
+		for i := 0; i < 3; i++ {
+			response := preflight("https://dashboard.example.org")
+
+			assertStatus(t, response.Code, http.StatusNoContent)
+			h := response.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.org" {
+				t.Errorf("Allow-Origin = %q", got)
+			}
+			if got := h.Get("Access-Control-Allow-Credentials"); got != "true" {
+				t.Errorf("Allow-Credentials = %q", got)
+			}
+			if got := h.Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodPut) {
+				t.Errorf("Allow-Methods = %q", got)
+			}
+			if got := h.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Authorization") {
+				t.Errorf("Allow-Headers = %q", got)
+			}
+			if got := h.Get("Access-Control-Max-Age"); got != "600" {
+				t.Errorf("Max-Age = %q", got)
+			}
+		}
+	})
+
+	t.Run("preflight from a wildcard origin", func(t *testing.T) {
+		response := preflight("https://pr-42.preview.example.org")
+
+		if got := response.Header().Get("Access-Control-Allow-Origin"); got != "https://pr-42.preview.example.org" {
+			t.Errorf("Allow-Origin = %q", got)
+		}
+	})
+
+	t.Run("preflight from an unknown origin", func(t *testing.T) {
+		response := preflight("https://evil.example.com")
+
+		assertStatus(t, response.Code, http.StatusNoContent)
+		for _, name := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Credentials"} {
+			if got := response.Header().Get(name); got != "" {
+				t.Errorf("%v = %q", name, got)
+			}
+		}
+	})
+
+	t.Run("credentialed request", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/person", nil)
+		req.Header.Set("Origin", "https://dashboard.example.org")
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusNotFound)
+		h := response.Header()
+		if got := h.Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.org" {
+			t.Errorf("Allow-Origin = %q", got)
+		}
+		for _, name := range []string{"ETag", "Location", "RateLimit-Remaining", "X-Next-Cursor"} {
+			if !strings.Contains(h.Get("Access-Control-Expose-Headers"), name) {
+				t.Errorf("%v is not exposed: %q", name, h.Get("Access-Control-Expose-Headers"))
+			}
+		}
+		if !strings.Contains(strings.Join(h.Values("Vary"), ","), "Origin") {
+			t.Errorf("Vary = %q", h.Values("Vary"))
+		}
+	})
+
+	t.Run("without Origin", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodOptions, "/person", nil)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusMethodNotAllowed)
+	})
+
+	t.Run("any origin with credentials", func(t *testing.T) {
+		cfg := DefaultCORSConfig()
+		cfg.AllowedOrigins = []string{"*"}
+		cfg.AllowCredentials = true
+		if _, err := NewCORS(cfg); err == nil {
+			t.Error("credentials allowed for any origin")
+		}
+	})
+}
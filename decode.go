@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// decodeJSON reads a single JSON value into v. The body is limited to the
+// configured size, must be valid UTF-8 and may not contain fields v doesn't have.
+// The returned error is meant for the client; decodeStatus gives its status code.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	return s.decodeBody(w, r, jsonCodec{}, v)
+}
+
+// decodeBody is decodeJSON for any representation.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, c Codec, v interface{}) error {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w: the limit is %d bytes", bodyTooLargeError, tooLarge.Limit)
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return emptyBodyError
+	}
+	return c.Decode(data, v)
+}
+
+func decodeStatus(err error) int {
+	if errors.Is(err, bodyTooLargeError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+func describeJSONError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		return fmt.Errorf("%w at offset %d: %v", malformedJSONError, syntaxErr.Offset, syntaxErr)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("%w: field %q must be %s", malformedJSONError, typeErr.Field, typeErr.Type)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return fmt.Errorf("%w: unexpected end of body", malformedJSONError)
+	}
+	// encoding/json reports unknown fields as `json: unknown field "name"`.
+	var field string
+	if _, scanErr := fmt.Sscanf(err.Error(), "json: unknown field %q", &field); scanErr == nil {
+		return fmt.Errorf("%w %q", unknownFieldError, field)
+	}
+	return fmt.Errorf("%w: %v", malformedJSONError, err)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStrictDecoding(t *testing.T) {
+	store, _ := NewWebhookStore("")
+	server := NewServer(NewInMemoryPersonStorage(), logBody, WithMaxBodySize(256),
+		WithWebhooks(NewWebhookDispatcher(store)))
+	joe := `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe", "communications": [{"value": "box@mail.ua"}]}`
+
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		error                    string
+	}{
+		{"valid", "POST", "/person", joe, http.StatusCreated, ""},
+		{"unknown field", "PUT", "/person",
+			`{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe", "comunications": []}`,
+			http.StatusBadRequest, `unknown field "comunications"`},
+		{"trailing value", "PUT", "/person", joe + ` {}`, http.StatusBadRequest, multipleJSONValuesError.Error()},
+		{"trailing garbage", "PUT", "/person", joe + `garbage`, http.StatusBadRequest, multipleJSONValuesError.Error()},
+		{"trailing whitespace", "PUT", "/person", joe + "\n", http.StatusOK, ""},
+		{"too large", "POST", "/person", `{"name": "` + strings.Repeat("a", 300) + `"}`,
+			http.StatusRequestEntityTooLarge, "request body too large: the limit is 256 bytes"},
+		{"invalid utf-8", "PUT", "/person",
+			`{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Jo` + "\xff" + `"}`,
+			http.StatusBadRequest, invalidUTF8Error.Error()},
+		{"empty", "POST", "/person", ``, http.StatusBadRequest, emptyBodyError.Error()},
+		{"wrong type", "POST", "/person", `{"name": 1}`, http.StatusBadRequest, `malformed JSON: field "name" must be string`},
+		{"truncated", "POST", "/person", `{"name": "Joe"`, http.StatusBadRequest, "malformed JSON: unexpected end of body"},
+		{"graphql unknown field", "POST", graphqlPath, `{"query": "{ persons { totalCount } }", "variable": {}}`,
+			http.StatusBadRequest, `unknown field "variable"`},
+		{"webhook unknown field", "POST", webhooksPath, `{"url": "http://localhost", "event": ["created"]}`,
+			http.StatusBadRequest, `unknown field "event"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", contentTypeJSON)
+			setRequestAuth(req)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, req)
+
+			assertStatus(t, response.Code, tt.status)
+			if tt.error == "" {
+				return
+			}
+			resp := ErrorResponse{}
+			json.Unmarshal(response.Body.Bytes(), &resp)
+			if resp.Error != tt.error {
+				t.Errorf("error = %q, want %q", resp.Error, tt.error)
+			}
+		})
+	}
+}
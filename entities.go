@@ -1,17 +1,45 @@
 package main
 
 import (
+	"encoding/xml"
+	"strings"
+	"unicode"
+
 	uuid "github.com/satori/go.uuid"
 )
 
+const (
+	CommunicationEmail = "email"
+	CommunicationPhone = "phone"
+	CommunicationOther = "other"
+)
+
 type Person struct {
-	ID             uuid.UUID        `json:"id"`
-	Name           string           `json:"name"`
-	Communications []*Communication `json:"communications"`
+	XMLName        xml.Name         `json:"-" xml:"person" yaml:"-" msgpack:"-"`
+	ID             uuid.UUID        `json:"id" xml:"id" yaml:"id" msgpack:"id"`
+	Name           string           `json:"name" xml:"name" yaml:"name" msgpack:"name"`
+	Communications []*Communication `json:"communications" xml:"communications>communication" yaml:"communications" msgpack:"communications"`
+}
+
+func (p *Person) Validate() error {
+	if uuid.Equal(p.ID, uuid.Nil) || strings.TrimSpace(p.Name) == "" {
+		return notValidPersonError
+	}
+	return nil
 }
 
 type Communication struct {
-	Value string `json:"value"`
+	Value string `json:"value" xml:"value" yaml:"value" msgpack:"value"`
+}
+
+func (c *Communication) Kind() string {
+	if strings.Contains(c.Value, "@") {
+		return CommunicationEmail
+	}
+	if strings.HasPrefix(c.Value, "+") || strings.IndexFunc(c.Value, unicode.IsDigit) == 0 {
+		return CommunicationPhone
+	}
+	return CommunicationOther
 }
 
 type MongoPerson struct {
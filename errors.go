@@ -3,9 +3,29 @@ package main
 import "errors"
 
 var (
-	personExistError      = errors.New("person already exist")
-	notValidPersonError   = errors.New("person not valid")
-	wrongContentTypeError = errors.New("wrong content type")
-	invalidUuidError      = errors.New("invalid uuid")
-	personNotFoundError   = errors.New("person not found")
+	personExistError                = errors.New("person already exist")
+	notValidPersonError             = errors.New("person not valid")
+	wrongContentTypeError           = errors.New("wrong content type")
+	invalidUuidError                = errors.New("invalid uuid")
+	personNotFoundError             = errors.New("person not found")
+	subscriptionExistError          = errors.New("subscription already exist")
+	subscriptionNotFoundError       = errors.New("subscription not found")
+	notValidSubscriptionError       = errors.New("subscription not valid")
+	deliveryNotFoundError           = errors.New("delivery not found")
+	streamingUnsupportedError       = errors.New("streaming unsupported")
+	invalidEventIDError             = errors.New("invalid event id")
+	invalidCursorError              = errors.New("invalid cursor")
+	invalidLimitError               = errors.New("invalid limit")
+	rateLimitExceededError          = errors.New("rate limit exceeded")
+	bodyTooLargeError               = errors.New("request body too large")
+	emptyBodyError                  = errors.New("request body is empty")
+	invalidUTF8Error                = errors.New("request body is not valid UTF-8")
+	malformedJSONError              = errors.New("malformed JSON")
+	unknownFieldError               = errors.New("unknown field")
+	multipleJSONValuesError         = errors.New("request body must contain a single JSON value")
+	malformedBodyError              = errors.New("malformed request body")
+	multipleValuesError             = errors.New("request body must contain a single value")
+	notAcceptableError              = errors.New("none of the accepted media types is supported")
+	unsupportedContentEncodingError = errors.New("unsupported content encoding")
+	storageUnavailableError         = errors.New("storage temporarily unavailable")
 )
@@ -0,0 +1,104 @@
+package main
+
+import "sync"
+
+type sequencedEvent struct {
+	Seq uint64
+	*PersonEvent
+}
+
+// EventBus fans person events out to in-process subscribers and keeps the
+// last events in a bounded buffer so reconnecting clients can resume.
+type EventBus struct {
+	mu          sync.Mutex
+	seq         uint64
+	buffer      []*sequencedEvent
+	size        int
+	subscribers map[chan *sequencedEvent]struct{}
+	closed      bool
+}
+
+func NewEventBus(size int) *EventBus {
+	return &EventBus{
+		size:        size,
+		subscribers: make(map[chan *sequencedEvent]struct{}),
+	}
+}
+
+// Publish satisfies EventListener.
+func (b *EventBus) Publish(e *PersonEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	se := &sequencedEvent{b.seq, e}
+	b.buffer = append(b.buffer, se)
+	if len(b.buffer) > b.size {
+		b.buffer = b.buffer[len(b.buffer)-b.size:]
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- se:
+		default:
+			// The subscriber can't keep up; drop it so it reconnects with Last-Event-ID.
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the buffered events published after lastSeq and a channel
+// for the following ones. The channel is closed by cancel or when the
+// subscriber falls too far behind.
+//
+// Sequence numbers are counted per process and start over on a restart. A
+// lastSeq ahead of the bus must come from an earlier run or another replica,
+// so the whole buffer is replayed rather than skipping events the client never saw.
+func (b *EventBus) Subscribe(lastSeq uint64) ([]*sequencedEvent, <-chan *sequencedEvent, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var replay []*sequencedEvent
+	if lastSeq > 0 {
+		if lastSeq > b.seq {
+			lastSeq = 0
+		}
+		for _, se := range b.buffer {
+			if se.Seq > lastSeq {
+				replay = append(replay, se)
+			}
+		}
+	}
+
+	ch := make(chan *sequencedEvent, eventSubscriberBuffer)
+	if b.closed {
+		close(ch)
+		return replay, ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+	return replay, ch, cancel
+}
+
+// Close ends every subscription so streaming responses finish and a server
+// shutdown doesn't wait for them. Clients reconnect with Last-Event-ID.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
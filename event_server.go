@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const eventsPath = "/person/events"
+
+// eventsHandler streams person changes as Server-Sent Events.
+// Supported filters are ?type=created,updated and ?person_id=<uuid>.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleError(streamingUnsupportedError, w, http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := newEventFilter(r)
+	if err != nil {
+		handleError(err, w, http.StatusBadRequest)
+		return
+	}
+
+	var lastSeq uint64
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		lastSeq, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			handleError(invalidEventIDError, w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// The stream outlives the server write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	replay, events, cancel := s.events.Subscribe(lastSeq)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for _, se := range replay {
+		if filter.matches(se.PersonEvent) {
+			writeEvent(w, se)
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case se, ok := <-events:
+			if !ok {
+				return
+			}
+			if filter.matches(se.PersonEvent) {
+				writeEvent(w, se)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, se *sequencedEvent) {
+	data, err := json.Marshal(se.PersonEvent)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", se.Seq, se.Type, data)
+}
+
+type eventFilter struct {
+	types    map[PersonEventType]bool
+	personID uuid.UUID
+}
+
+func newEventFilter(r *http.Request) (*eventFilter, error) {
+	f := &eventFilter{types: make(map[PersonEventType]bool)}
+	for _, param := range r.URL.Query()["type"] {
+		for _, t := range strings.Split(param, ",") {
+			if t != "" {
+				f.types[PersonEventType(t)] = true
+			}
+		}
+	}
+
+	if idStr := getQueryParam(r, "person_id"); idStr != "" {
+		id, err := uuid.FromString(idStr)
+		if err != nil {
+			return nil, invalidUuidError
+		}
+		f.personID = id
+	}
+	return f, nil
+}
+
+func (f *eventFilter) matches(e *PersonEvent) bool {
+	if len(f.types) != 0 && !f.types[e.Type] {
+		return false
+	}
+	if !uuid.Equal(f.personID, uuid.Nil) && !uuid.Equal(f.personID, e.PersonID) {
+		return false
+	}
+	return true
+}
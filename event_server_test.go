@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestPersonEvents(t *testing.T) {
+	joe := &Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"), Name: "Joe"}
+	louis := &Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69535"), Name: "Louis"}
+
+	bus := NewEventBus(eventBufferSize)
+	storage := NewEventStorage(NewInMemoryPersonStorage(), bus.Publish)
+	server := httptest.NewServer(NewServer(storage, logBody, WithEventBus(bus)))
+	defer server.Close()
+
+	storage.Add(joe)
+	storage.Add(louis)
+	storage.UpdatePerson(&Person{ID: joe.ID, Name: "Joseph"})
+
+	t.Run("resume from Last-Event-ID", func(t *testing.T) {
+		lines := readEvents(t, server.URL+"/person/events", "1", 2)
+		assertEventLines(t, lines, []string{"id: 2", "id: 3"})
+	})
+
+	t.Run("Last-Event-ID from another process", func(t *testing.T) {
+		lines := readEvents(t, server.URL+"/person/events", "100", 3)
+		joined := strings.Join(lines, "\n")
+		for _, id := range []string{"id: 1", "id: 2", "id: 3"} {
+			if !strings.Contains(joined, id) {
+				t.Errorf("stream %q does not contain %q", joined, id)
+			}
+		}
+	})
+
+	t.Run("filter by type and person", func(t *testing.T) {
+		lines := readEvents(t, server.URL+"/person/events?type=updated&person_id="+joe.ID.String(), "1", 1)
+		assertEventLines(t, lines, []string{"id: 3"})
+	})
+
+	t.Run("live events", func(t *testing.T) {
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			storage.DeletePerson(louis.ID)
+		}()
+		lines := readEvents(t, server.URL+"/person/events?type=deleted", "", 1)
+		assertEventLines(t, lines, []string{"id: 4", "event: deleted"})
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/person/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assertStatus(t, resp.StatusCode, http.StatusUnauthorized)
+	})
+}
+
+// readEvents reads the stream until n events were received and returns their lines.
+func readEvents(t *testing.T, url, lastEventID string, n int) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	setRequestAuth(req)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assertStatus(t, resp.StatusCode, http.StatusOK)
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for n > 0 && scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			n--
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func assertEventLines(t *testing.T, lines, want []string) {
+	t.Helper()
+
+	joined := strings.Join(lines, "\n")
+	for _, w := range want {
+		if !strings.Contains(joined, w) {
+			t.Errorf("stream %q does not contain %q", joined, w)
+		}
+	}
+	if strings.Contains(joined, "id: 1\n") {
+		t.Errorf("stream %q replayed an already seen event", joined)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type PersonEventType string
+
+const (
+	PersonCreated PersonEventType = "created"
+	PersonUpdated PersonEventType = "updated"
+	PersonDeleted PersonEventType = "deleted"
+)
+
+type PersonEvent struct {
+	ID       uuid.UUID       `json:"id"`
+	Type     PersonEventType `json:"type"`
+	PersonID uuid.UUID       `json:"person_id"`
+	Person   *Person         `json:"person"`
+	Time     time.Time       `json:"time"`
+}
+
+func NewPersonEvent(eventType PersonEventType, p *Person) *PersonEvent {
+	return &PersonEvent{
+		ID:       uuid.NewV4(),
+		Type:     eventType,
+		PersonID: p.ID,
+		Person:   p,
+		Time:     time.Now().UTC(),
+	}
+}
+
+type EventListener func(*PersonEvent)
+
+// EventStorage wraps a Storage and notifies listeners after every successful write.
+type EventStorage struct {
+	Storage
+	listeners []EventListener
+}
+
+func NewEventStorage(storage Storage, listeners ...EventListener) *EventStorage {
+	return &EventStorage{storage, listeners}
+}
+
+func (s *EventStorage) WithContext(ctx context.Context) Storage {
+	return &EventStorage{storageWithContext(s.Storage, ctx), s.listeners}
+}
+
+func (s *EventStorage) Add(person *Person) (*Person, error) {
+	p, err := s.Storage.Add(person)
+	if err != nil {
+		return p, err
+	}
+	s.notify(NewPersonEvent(PersonCreated, orPerson(p, person)))
+	return p, nil
+}
+
+func (s *EventStorage) UpdatePerson(person *Person) (*Person, error) {
+	p, err := s.Storage.UpdatePerson(person)
+	if err != nil {
+		return p, err
+	}
+	s.notify(NewPersonEvent(PersonUpdated, orPerson(p, person)))
+	return p, nil
+}
+
+func (s *EventStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	p, err := s.Storage.DeletePerson(id)
+	if err != nil {
+		return p, err
+	}
+	s.notify(NewPersonEvent(PersonDeleted, orPerson(p, &Person{ID: id})))
+	return p, nil
+}
+
+func (s *EventStorage) notify(e *PersonEvent) {
+	for _, listener := range s.listeners {
+		listener(e)
+	}
+}
+
+func orPerson(p, fallback *Person) *Person {
+	if p != nil {
+		return p
+	}
+	return fallback
+}
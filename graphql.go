@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/graph-gophers/dataloader/v7"
+	graphql "github.com/graph-gophers/graphql-go"
+	uuid "github.com/satori/go.uuid"
+)
+
+const graphqlPath = "/graphql"
+
+const graphqlSchema = `
+	schema {
+		query: Query
+		mutation: Mutation
+	}
+
+	type Query {
+		person(id: ID!): Person
+		persons(name: String, communication: String, first: Int = 20, after: String): PersonConnection!
+	}
+
+	type Mutation {
+		addPerson(input: PersonInput!): Person!
+		updatePerson(input: PersonInput!): Person!
+		deletePerson(id: ID!): Person!
+	}
+
+	type Person {
+		id: ID!
+		name: String!
+		communications(kind: String): [Communication!]!
+	}
+
+	type Communication {
+		value: String!
+		kind: String!
+	}
+
+	type PersonConnection {
+		totalCount: Int!
+		edges: [PersonEdge!]!
+		pageInfo: PageInfo!
+	}
+
+	type PersonEdge {
+		cursor: String!
+		node: Person!
+	}
+
+	type PageInfo {
+		endCursor: String
+		hasNextPage: Boolean!
+	}
+
+	input PersonInput {
+		id: ID!
+		name: String!
+		communications: [CommunicationInput!]
+	}
+
+	input CommunicationInput {
+		value: String!
+	}
+`
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+func (s *Server) graphqlHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !isContentTypeJSON(r) {
+		handleError(wrongContentTypeError, w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	req := &graphqlRequest{}
+	if err := s.decodeJSON(w, r, req); err != nil {
+		handleError(err, w, decodeStatus(err))
+		return
+	}
+
+	ctx := withPersonLoader(r.Context(), s.storage)
+	resp := s.graphql.Exec(ctx, req.Query, req.OperationName, req.Variables)
+	json.NewEncoder(w).Encode(resp)
+}
+
+type personLoaderKey struct{}
+
+// withPersonLoader attaches a per-request loader that batches person lookups by ID
+// into a single GetPersonsByIDs call, so resolving many persons costs one round trip.
+func withPersonLoader(ctx context.Context, storage Storage) context.Context {
+	loader := dataloader.NewBatchedLoader(func(ctx context.Context, ids []uuid.UUID) []*dataloader.Result[*Person] {
+		results := make([]*dataloader.Result[*Person], len(ids))
+
+		pp, err := storageWithContext(storage, ctx).GetPersonsByIDs(ids)
+		if err != nil {
+			for i := range results {
+				results[i] = &dataloader.Result[*Person]{Error: err}
+			}
+			return results
+		}
+
+		byID := make(map[uuid.UUID]*Person, len(pp))
+		for _, p := range pp {
+			byID[p.ID] = p
+		}
+		for i, id := range ids {
+			if p, ok := byID[id]; ok {
+				results[i] = &dataloader.Result[*Person]{Data: p}
+			} else {
+				results[i] = &dataloader.Result[*Person]{Error: personNotFoundError}
+			}
+		}
+		return results
+	})
+	return context.WithValue(ctx, personLoaderKey{}, loader)
+}
+
+func personLoader(ctx context.Context) *dataloader.Loader[uuid.UUID, *Person] {
+	return ctx.Value(personLoaderKey{}).(*dataloader.Loader[uuid.UUID, *Person])
+}
+
+// graphqlError exposes the same error classes as the HTTP status codes in the "code" extension.
+type graphqlError struct {
+	err error
+}
+
+func (e graphqlError) Error() string {
+	return e.err.Error()
+}
+
+func (e graphqlError) Extensions() map[string]interface{} {
+	code := "INTERNAL"
+	switch e.err {
+	case personNotFoundError:
+		code = "NOT_FOUND"
+	case personExistError:
+		code = "ALREADY_EXISTS"
+	case notValidPersonError, invalidUuidError, invalidCursorError:
+		code = "BAD_USER_INPUT"
+	}
+	return map[string]interface{}{"code": code}
+}
+
+type graphqlResolver struct {
+	storage Storage
+}
+
+func (r *graphqlResolver) Person(ctx context.Context, args struct{ ID graphql.ID }) (*personResolver, error) {
+	id, err := uuid.FromString(string(args.ID))
+	if err != nil {
+		return nil, graphqlError{invalidUuidError}
+	}
+
+	p, err := personLoader(ctx).Load(ctx, id)()
+	if err == personNotFoundError {
+		return nil, nil
+	} else if err != nil {
+		return nil, graphqlError{err}
+	}
+	return &personResolver{p}, nil
+}
+
+type personsArgs struct {
+	Name          *string
+	Communication *string
+	First         int32
+	After         *string
+}
+
+func (r *graphqlResolver) Persons(ctx context.Context, args personsArgs) (*personConnectionResolver, error) {
+	var pp []*Person
+	var err error
+	if args.Name != nil || args.Communication != nil {
+		pp, err = searchPersons(ctx, r.storage, stringValue(args.Name), stringValue(args.Communication))
+	} else {
+		pp, err = storageWithContext(r.storage, ctx).GetAll()
+	}
+	if err != nil && err != personNotFoundError {
+		return nil, graphqlError{err}
+	}
+
+	sort.Slice(pp, func(i, j int) bool { return pp[i].ID.String() < pp[j].ID.String() })
+	loader := personLoader(ctx)
+	for _, p := range pp {
+		loader.Prime(ctx, p.ID, p)
+	}
+
+	start := 0
+	if args.After != nil {
+		after, err := decodeCursor(*args.After)
+		if err != nil {
+			return nil, graphqlError{err}
+		}
+		start = sort.Search(len(pp), func(i int) bool { return pp[i].ID.String() > after })
+	}
+	end := start + int(args.First)
+	if args.First < 0 || end > len(pp) {
+		end = len(pp)
+	}
+
+	return &personConnectionResolver{pp[start:end], len(pp), end < len(pp)}, nil
+}
+
+type personInput struct {
+	ID             graphql.ID
+	Name           string
+	Communications *[]struct{ Value string }
+}
+
+func (in personInput) toPerson() (*Person, error) {
+	id, err := uuid.FromString(string(in.ID))
+	if err != nil {
+		return nil, invalidUuidError
+	}
+
+	p := &Person{ID: id, Name: in.Name, Communications: []*Communication{}}
+	if in.Communications != nil {
+		for _, comm := range *in.Communications {
+			p.Communications = append(p.Communications, &Communication{Value: comm.Value})
+		}
+	}
+	return p, p.Validate()
+}
+
+func (r *graphqlResolver) AddPerson(ctx context.Context, args struct{ Input personInput }) (*personResolver, error) {
+	p, err := args.Input.toPerson()
+	if err != nil {
+		return nil, graphqlError{err}
+	}
+
+	added, err := storageWithContext(r.storage, ctx).Add(p)
+	if err != nil {
+		return nil, graphqlError{err}
+	}
+	return &personResolver{orPerson(added, p)}, nil
+}
+
+func (r *graphqlResolver) UpdatePerson(ctx context.Context, args struct{ Input personInput }) (*personResolver, error) {
+	p, err := args.Input.toPerson()
+	if err != nil {
+		return nil, graphqlError{err}
+	}
+
+	updated, err := storageWithContext(r.storage, ctx).UpdatePerson(p)
+	if err != nil {
+		return nil, graphqlError{err}
+	}
+	return &personResolver{orPerson(updated, p)}, nil
+}
+
+func (r *graphqlResolver) DeletePerson(ctx context.Context, args struct{ ID graphql.ID }) (*personResolver, error) {
+	id, err := uuid.FromString(string(args.ID))
+	if err != nil {
+		return nil, graphqlError{invalidUuidError}
+	}
+
+	p, err := storageWithContext(r.storage, ctx).DeletePerson(id)
+	if err != nil {
+		return nil, graphqlError{err}
+	}
+	return &personResolver{orPerson(p, &Person{ID: id})}, nil
+}
+
+type personResolver struct {
+	p *Person
+}
+
+func (r *personResolver) ID() graphql.ID {
+	return graphql.ID(r.p.ID.String())
+}
+
+func (r *personResolver) Name() string {
+	return r.p.Name
+}
+
+func (r *personResolver) Communications(args struct{ Kind *string }) []*communicationResolver {
+	cc := []*communicationResolver{}
+	for _, comm := range r.p.Communications {
+		if args.Kind == nil || comm.Kind() == *args.Kind {
+			cc = append(cc, &communicationResolver{comm})
+		}
+	}
+	return cc
+}
+
+type communicationResolver struct {
+	c *Communication
+}
+
+func (r *communicationResolver) Value() string {
+	return r.c.Value
+}
+
+func (r *communicationResolver) Kind() string {
+	return r.c.Kind()
+}
+
+type personConnectionResolver struct {
+	pp          []*Person
+	total       int
+	hasNextPage bool
+}
+
+func (r *personConnectionResolver) TotalCount() int32 {
+	return int32(r.total)
+}
+
+func (r *personConnectionResolver) Edges() []*personEdgeResolver {
+	edges := make([]*personEdgeResolver, 0, len(r.pp))
+	for _, p := range r.pp {
+		edges = append(edges, &personEdgeResolver{p})
+	}
+	return edges
+}
+
+func (r *personConnectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.pp) != 0 {
+		cursor := encodeCursor(r.pp[len(r.pp)-1].ID.String())
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type personEdgeResolver struct {
+	p *Person
+}
+
+func (r *personEdgeResolver) Cursor() string {
+	return encodeCursor(r.p.ID.String())
+}
+
+func (r *personEdgeResolver) Node() *personResolver {
+	return &personResolver{r.p}
+}
+
+type pageInfoResolver struct {
+	endCursor   *string
+	hasNextPage bool
+}
+
+func (r *pageInfoResolver) EndCursor() *string {
+	return r.endCursor
+}
+
+func (r *pageInfoResolver) HasNextPage() bool {
+	return r.hasNextPage
+}
+
+func encodeCursor(id string) string {
+	return base64.StdEncoding.EncodeToString([]byte(id))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	id, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", invalidCursorError
+	}
+	return string(id), nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
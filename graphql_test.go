@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type countingStorage struct {
+	*InMemoryPersonStorage
+	batches int
+}
+
+func (s *countingStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	s.batches++
+	return s.InMemoryPersonStorage.GetPersonsByIDs(ids)
+}
+
+func TestGraphQL(t *testing.T) {
+	storage := &countingStorage{InMemoryPersonStorage: NewInMemoryPersonStorage()}
+	server := NewServer(storage, logBody)
+
+	t.Run("add persons", func(t *testing.T) {
+		for _, id := range []string{"02a883a3-13c4-4624-bbba-edc744f69534", "02a883a3-13c4-4624-bbba-edc744f69535"} {
+			resp := graphqlQuery(t, server, `mutation($id: ID!) {
+				addPerson(input: {id: $id, name: "Joe", communications: [{value: "box@mail.ua"}, {value: "+380974583947"}]}) { id }
+			}`, map[string]interface{}{"id": id})
+			assertNoGraphQLErrors(t, resp)
+		}
+	})
+
+	t.Run("batch person lookups", func(t *testing.T) {
+		resp := graphqlQuery(t, server, `{
+			a: person(id: "02a883a3-13c4-4624-bbba-edc744f69534") { name communications(kind: "phone") { value } }
+			b: person(id: "02a883a3-13c4-4624-bbba-edc744f69535") { name }
+			c: person(id: "02a883a3-13c4-4624-bbba-edc744f69530") { name }
+		}`, nil)
+		assertNoGraphQLErrors(t, resp)
+
+		if storage.batches != 1 {
+			t.Errorf("got %d storage round trips, want 1", storage.batches)
+		}
+		data := resp["data"].(map[string]interface{})
+		if data["c"] != nil {
+			t.Errorf("unknown person resolved to %v", data["c"])
+		}
+		comms := data["a"].(map[string]interface{})["communications"].([]interface{})
+		if len(comms) != 1 {
+			t.Errorf("got %d phone communications, want 1", len(comms))
+		}
+	})
+
+	t.Run("paginate persons", func(t *testing.T) {
+		resp := graphqlQuery(t, server, `{ persons(name: "Joe", first: 1) { totalCount edges { node { id } } pageInfo { endCursor hasNextPage } } }`, nil)
+		assertNoGraphQLErrors(t, resp)
+		conn := resp["data"].(map[string]interface{})["persons"].(map[string]interface{})
+		pageInfo := conn["pageInfo"].(map[string]interface{})
+		if conn["totalCount"].(float64) != 2 || pageInfo["hasNextPage"] != true {
+			t.Fatalf("unexpected first page %v", conn)
+		}
+
+		resp = graphqlQuery(t, server, `query($after: String) { persons(first: 1, after: $after) { edges { node { id } } pageInfo { hasNextPage } } }`,
+			map[string]interface{}{"after": pageInfo["endCursor"]})
+		assertNoGraphQLErrors(t, resp)
+		conn = resp["data"].(map[string]interface{})["persons"].(map[string]interface{})
+		edges := conn["edges"].([]interface{})
+		if len(edges) != 1 || conn["pageInfo"].(map[string]interface{})["hasNextPage"] != false {
+			t.Errorf("unexpected second page %v", conn)
+		}
+	})
+
+	t.Run("delete unknown person", func(t *testing.T) {
+		resp := graphqlQuery(t, server, `mutation { deletePerson(id: "02a883a3-13c4-4624-bbba-edc744f69530") { id } }`, nil)
+		errs, _ := resp["errors"].([]interface{})
+		if len(errs) != 1 || !strings.Contains(string(mustMarshal(errs)), "NOT_FOUND") {
+			t.Errorf("got errors %v, want NOT_FOUND", errs)
+		}
+	})
+}
+
+func graphqlQuery(t *testing.T, server http.Handler, query string, variables map[string]interface{}) map[string]interface{} {
+	t.Helper()
+
+	body := mustMarshal(graphqlRequest{Query: query, Variables: variables})
+	req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	setRequestAuth(req)
+	req.Header.Add("Content-Type", contentTypeJSON)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, req)
+
+	assertStatus(t, response.Code, http.StatusOK)
+	var resp map[string]interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func assertNoGraphQLErrors(t *testing.T, resp map[string]interface{}) {
+	t.Helper()
+	if errs, ok := resp["errors"]; ok {
+		t.Fatalf("got errors %v", errs)
+	}
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,199 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative personpb/person.proto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"PersonService/personpb"
+
+	uuid "github.com/satori/go.uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer implements personpb.PersonServiceServer on top of the same
+// Storage, authentication and validation as the HTTP Server.
+type GRPCServer struct {
+	personpb.UnimplementedPersonServiceServer
+	storage Storage
+}
+
+func NewGRPCServer(storage Storage, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryAuthentication),
+		grpc.ChainStreamInterceptor(streamAuthentication),
+	)
+	server := grpc.NewServer(opts...)
+	personpb.RegisterPersonServiceServer(server, &GRPCServer{storage: storage})
+	return server
+}
+
+func (s *GRPCServer) Create(ctx context.Context, req *personpb.CreateRequest) (*personpb.Person, error) {
+	p, err := personFromProto(req.GetPerson())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	added, err := storageWithContext(s.storage, ctx).Add(p)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personToProto(orPerson(added, p)), nil
+}
+
+func (s *GRPCServer) Get(ctx context.Context, req *personpb.GetRequest) (*personpb.Person, error) {
+	id, err := uuid.FromString(req.GetId())
+	if err != nil {
+		return nil, grpcError(invalidUuidError)
+	}
+
+	p, err := storageWithContext(s.storage, ctx).GetPersonByID(id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personToProto(p), nil
+}
+
+func (s *GRPCServer) List(_ *personpb.ListRequest, stream personpb.PersonService_ListServer) error {
+	pp, err := storageWithContext(s.storage, stream.Context()).GetAll()
+	if err == personNotFoundError {
+		return nil
+	} else if err != nil {
+		return grpcError(err)
+	}
+
+	for _, p := range pp {
+		if err := stream.Send(personToProto(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *GRPCServer) Search(ctx context.Context, req *personpb.SearchRequest) (*personpb.SearchResponse, error) {
+	if req.GetName() == "" && req.GetCommunication() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name or communication is required")
+	}
+
+	pp, err := searchPersons(ctx, s.storage, req.GetName(), req.GetCommunication())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &personpb.SearchResponse{}
+	for _, p := range pp {
+		resp.Persons = append(resp.Persons, personToProto(p))
+	}
+	return resp, nil
+}
+
+func (s *GRPCServer) Update(ctx context.Context, req *personpb.UpdateRequest) (*personpb.Person, error) {
+	p, err := personFromProto(req.GetPerson())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	updated, err := storageWithContext(s.storage, ctx).UpdatePerson(p)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personToProto(orPerson(updated, p)), nil
+}
+
+func (s *GRPCServer) Delete(ctx context.Context, req *personpb.DeleteRequest) (*personpb.Person, error) {
+	id, err := uuid.FromString(req.GetId())
+	if err != nil {
+		return nil, grpcError(invalidUuidError)
+	}
+
+	p, err := storageWithContext(s.storage, ctx).DeletePerson(id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return personToProto(orPerson(p, &Person{ID: id})), nil
+}
+
+func personToProto(p *Person) *personpb.Person {
+	pb := &personpb.Person{Id: p.ID.String(), Name: p.Name}
+	for _, comm := range p.Communications {
+		pb.Communications = append(pb.Communications, &personpb.Communication{Value: comm.Value})
+	}
+	return pb
+}
+
+func personFromProto(pb *personpb.Person) (*Person, error) {
+	if pb == nil {
+		return nil, notValidPersonError
+	}
+	id, err := uuid.FromString(pb.GetId())
+	if err != nil {
+		return nil, invalidUuidError
+	}
+
+	p := &Person{ID: id, Name: pb.GetName(), Communications: []*Communication{}}
+	for _, comm := range pb.GetCommunications() {
+		p.Communications = append(p.Communications, &Communication{Value: comm.GetValue()})
+	}
+	return p, p.Validate()
+}
+
+// grpcError maps storage and validation errors to gRPC status codes
+// the same way the HTTP handlers map them to status codes.
+func grpcError(err error) error {
+	if errors.Is(err, storageUnavailableError) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	switch err {
+	case personNotFoundError:
+		return status.Error(codes.NotFound, err.Error())
+	case personExistError:
+		return status.Error(codes.AlreadyExists, err.Error())
+	case notValidPersonError, invalidUuidError:
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func unaryAuthentication(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !authenticateContext(ctx) {
+		return nil, status.Error(codes.Unauthenticated, http.StatusText(http.StatusUnauthorized))
+	}
+	return handler(ctx, req)
+}
+
+func streamAuthentication(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !authenticateContext(ss.Context()) {
+		return status.Error(codes.Unauthenticated, http.StatusText(http.StatusUnauthorized))
+	}
+	return handler(srv, ss)
+}
+
+// authenticateContext accepts a verified client certificate, like requestIdentity
+// does for HTTP, or the Basic credentials sent in the "authorization" metadata.
+func authenticateContext(ctx context.Context) bool {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			chains := info.State.VerifiedChains
+			if len(chains) != 0 && len(chains[0]) != 0 && certificateIdentity(chains[0][0]) != "" {
+				return true
+			}
+		}
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+
+	r := &http.Request{Header: http.Header{"Authorization": md.Get("authorization")}}
+	username, password, ok := r.BasicAuth()
+	return ok && authenticate(username, password)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"testing"
+
+	"PersonService/personpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCServer(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(NewInMemoryPersonStorage())
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := personpb.NewPersonServiceClient(conn)
+
+	auth := base64.StdEncoding.EncodeToString([]byte(authLogin + ":" + authPassword))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+auth)
+	joe := &personpb.Person{
+		Id:             "02a883a3-13c4-4624-bbba-edc744f69534",
+		Name:           "Joe",
+		Communications: []*personpb.Communication{{Value: "box@mail.ua"}},
+	}
+
+	t.Run("unauthenticated", func(t *testing.T) {
+		_, err := client.Get(context.Background(), &personpb.GetRequest{Id: joe.Id})
+		assertCode(t, err, codes.Unauthenticated)
+	})
+
+	t.Run("create", func(t *testing.T) {
+		_, err := client.Create(ctx, &personpb.CreateRequest{Person: joe})
+		assertCode(t, err, codes.OK)
+
+		_, err = client.Create(ctx, &personpb.CreateRequest{Person: joe})
+		assertCode(t, err, codes.AlreadyExists)
+
+		_, err = client.Create(ctx, &personpb.CreateRequest{Person: &personpb.Person{Id: joe.Id}})
+		assertCode(t, err, codes.InvalidArgument)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		p, err := client.Get(ctx, &personpb.GetRequest{Id: joe.Id})
+		assertCode(t, err, codes.OK)
+		if p.GetName() != "Joe" || len(p.GetCommunications()) != 1 {
+			t.Errorf("unexpected person %v", p)
+		}
+
+		_, err = client.Get(ctx, &personpb.GetRequest{Id: "02a883a3-13c4-4624-bbba-edc744f69530"})
+		assertCode(t, err, codes.NotFound)
+	})
+
+	t.Run("list and search", func(t *testing.T) {
+		stream, err := client.List(ctx, &personpb.ListRequest{})
+		assertCode(t, err, codes.OK)
+		count := 0
+		for {
+			_, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			assertCode(t, err, codes.OK)
+			count++
+		}
+		if count != 1 {
+			t.Errorf("got %d persons, want 1", count)
+		}
+
+		resp, err := client.Search(ctx, &personpb.SearchRequest{Communication: "box@mail.ua"})
+		assertCode(t, err, codes.OK)
+		if len(resp.GetPersons()) != 1 {
+			t.Errorf("got %d persons, want 1", len(resp.GetPersons()))
+		}
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		p, err := client.Update(ctx, &personpb.UpdateRequest{Person: &personpb.Person{Id: joe.Id, Name: "Louis"}})
+		assertCode(t, err, codes.OK)
+		if p.GetName() != "Louis" {
+			t.Errorf("got name %q, want Louis", p.GetName())
+		}
+
+		_, err = client.Delete(ctx, &personpb.DeleteRequest{Id: joe.Id})
+		assertCode(t, err, codes.OK)
+		_, err = client.Delete(ctx, &personpb.DeleteRequest{Id: joe.Id})
+		assertCode(t, err, codes.NotFound)
+	})
+}
+
+func assertCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("got code %v, want %v (%v)", got, want, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+type HealthCheck func(context.Context) error
+
+// Pinger is implemented by storages that can tell whether their backend is reachable.
+type Pinger interface {
+	Ping(context.Context) error
+}
+
+type CheckResult struct {
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Health runs the readiness checks. Once Drain is called readiness fails so
+// load balancers stop sending traffic while in-flight requests finish.
+type Health struct {
+	mu       sync.RWMutex
+	names    []string
+	checks   map[string]HealthCheck
+	timeout  time.Duration
+	draining atomic.Bool
+}
+
+func NewHealth(timeout time.Duration) *Health {
+	return &Health{checks: map[string]HealthCheck{}, timeout: timeout}
+}
+
+func (h *Health) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+func (h *Health) Drain() {
+	h.draining.Store(true)
+}
+
+// Check runs all checks concurrently, each bounded by the health timeout.
+func (h *Health) Check(ctx context.Context) *HealthResponse {
+	h.mu.RLock()
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+
+	resp := &HealthResponse{Status: healthStatusOK, Checks: map[string]CheckResult{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+			res := runCheck(ctx, check, h.timeout)
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[name] = res
+			if res.Status != healthStatusOK {
+				resp.Status = healthStatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	if h.draining.Load() {
+		resp.Status = healthStatusDraining
+	}
+	return resp
+}
+
+func runCheck(ctx context.Context, check HealthCheck, timeout time.Duration) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{Status: healthStatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = healthStatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (h *Health) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, &HealthResponse{Status: healthStatusOK})
+}
+
+func (h *Health) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, h.Check(r.Context()))
+}
+
+func writeHealth(w http.ResponseWriter, resp *HealthResponse) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != healthStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
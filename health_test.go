@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	probe := func(t *testing.T, server http.Handler, path string) (*httptest.ResponseRecorder, *HealthResponse) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+
+		if err := doc.validateResponse(req, response); err != nil {
+			t.Errorf("GET %s: %v", path, err)
+		}
+		resp := &HealthResponse{}
+		json.Unmarshal(response.Body.Bytes(), resp)
+		return response, resp
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		health := NewHealth(healthCheckTimeout)
+		health.AddCheck("memory", NewInMemoryPersonStorage().Ping)
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithHealth(health))
+
+		response, _ := probe(t, server, healthzPath)
+		assertStatus(t, response.Code, http.StatusOK)
+
+		response, resp := probe(t, server, readyzPath)
+		assertStatus(t, response.Code, http.StatusOK)
+		if resp.Checks["memory"].Status != healthStatusOK {
+			t.Errorf("unexpected checks %v", resp.Checks)
+		}
+	})
+
+	t.Run("failing and slow checks", func(t *testing.T) {
+		health := NewHealth(50 * time.Millisecond)
+		health.AddCheck("postgres", func(context.Context) error { return errors.New("connection refused") })
+		health.AddCheck("mongo", func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(time.Second)
+			return nil
+		})
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithHealth(health))
+
+		start := time.Now()
+		response, resp := probe(t, server, readyzPath)
+		if time.Since(start) > 500*time.Millisecond {
+			t.Error("readiness waited for the slow check")
+		}
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		if resp.Status != healthStatusFail || resp.Checks["postgres"].Error != "connection refused" || resp.Checks["mongo"].Error != context.DeadlineExceeded.Error() {
+			t.Errorf("unexpected response %+v", resp)
+		}
+
+		response, _ = probe(t, server, healthzPath)
+		assertStatus(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("draining", func(t *testing.T) {
+		health := NewHealth(healthCheckTimeout)
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithHealth(health))
+		health.Drain()
+
+		response, resp := probe(t, server, readyzPath)
+		assertStatus(t, response.Code, http.StatusServiceUnavailable)
+		if resp.Status != healthStatusDraining {
+			t.Errorf("status = %q, want %q", resp.Status, healthStatusDraining)
+		}
+	})
+}
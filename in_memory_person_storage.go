@@ -1,16 +1,122 @@
 package main
 
-import uuid "github.com/satori/go.uuid"
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
 
 type InMemoryPersonStorage struct {
 	data map[uuid.UUID]*Person
+	mu   sync.RWMutex
+	// log is nil unless the storage was opened with persistence.
+	log        *writeAheadLog
+	cfg        PersistenceConfig
+	snapshotMu sync.Mutex
 }
 
 func NewInMemoryPersonStorage() *InMemoryPersonStorage {
-	return &InMemoryPersonStorage{make(map[uuid.UUID]*Person)}
+	return &InMemoryPersonStorage{data: make(map[uuid.UUID]*Person)}
+}
+
+// OpenInMemoryPersonStorage returns a storage that keeps its data in cfg.Dir
+// across restarts. It recovers from the latest snapshot and the log written
+// after it; Run takes the periodic snapshots and Close writes a final one.
+func OpenInMemoryPersonStorage(cfg PersistenceConfig) (*InMemoryPersonStorage, error) {
+	l, data, err := openWAL(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &InMemoryPersonStorage{data: data, log: l, cfg: cfg}, nil
+}
+
+// Run syncs the log and takes snapshots until ctx is done.
+func (s *InMemoryPersonStorage) Run(ctx context.Context) {
+	if s.log == nil {
+		return
+	}
+	var syncs, snapshots <-chan time.Time
+	if s.log.policy == walSyncInterval && s.cfg.SyncInterval > 0 {
+		ticker := time.NewTicker(s.cfg.SyncInterval)
+		defer ticker.Stop()
+		syncs = ticker.C
+	}
+	if s.cfg.SnapshotInterval > 0 {
+		ticker := time.NewTicker(s.cfg.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncs:
+			if err := s.log.sync(); err != nil {
+				log.Error().Err(err).Msg("could not sync WAL")
+			}
+		case <-snapshots:
+			if err := s.Snapshot(); err != nil {
+				log.Error().Err(err).Msg("could not write snapshot")
+			}
+		}
+	}
+}
+
+// Snapshot writes the current data and drops the log it makes obsolete. Writes
+// only wait for the data to be copied, not for the snapshot to be written.
+func (s *InMemoryPersonStorage) Snapshot() error {
+	if s.log == nil {
+		return nil
+	}
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	if !s.log.changedSinceSnapshot() {
+		return nil
+	}
+
+	s.mu.RLock()
+	persons := make([]*Person, 0, len(s.data))
+	for _, p := range s.data {
+		persons = append(persons, p)
+	}
+	seq, err := s.log.rotate()
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return s.log.writeSnapshot(seq, persons)
+}
+
+// Close writes a snapshot, so the next start doesn't have to replay the log, and closes the log.
+func (s *InMemoryPersonStorage) Close() error {
+	if s.log == nil {
+		return nil
+	}
+	if err := s.Snapshot(); err != nil {
+		log.Error().Err(err).Msg("could not write snapshot")
+	}
+	return s.log.close()
+}
+
+// Ping always succeeds, the data lives in the process.
+func (s *InMemoryPersonStorage) Ping(context.Context) error {
+	return nil
+}
+
+func (s *InMemoryPersonStorage) Count(context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data), nil
 }
 
 func (s *InMemoryPersonStorage) GetAll() ([]*Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	persons := []*Person{}
 	for _, person := range s.data {
 		persons = append(persons, person)
@@ -19,16 +125,23 @@ func (s *InMemoryPersonStorage) GetAll() ([]*Person, error) {
 }
 
 func (s *InMemoryPersonStorage) Add(person *Person) (*Person, error) {
-	p, err := s.GetPersonByID(person.ID)
-	if err == nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p, ok := s.data[person.ID]; ok {
 		return p, personExistError
 	}
-
+	if err := s.log.put(person); err != nil {
+		return nil, err
+	}
 	s.data[person.ID] = person
-	return p, nil
+	return person, nil
 }
 
 func (s *InMemoryPersonStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	p, ok := s.data[id]
 	if !ok {
 		return nil, personNotFoundError
@@ -36,7 +149,23 @@ func (s *InMemoryPersonStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
 	return p, nil
 }
 
+func (s *InMemoryPersonStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	persons := []*Person{}
+	for _, id := range ids {
+		if p, ok := s.data[id]; ok {
+			persons = append(persons, p)
+		}
+	}
+	return persons, nil
+}
+
 func (s *InMemoryPersonStorage) GetPersonsByName(name string) ([]*Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	persons := []*Person{}
 	for _, val := range s.data {
 		if val.Name == name {
@@ -50,6 +179,9 @@ func (s *InMemoryPersonStorage) GetPersonsByName(name string) ([]*Person, error)
 }
 
 func (s *InMemoryPersonStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	persons := []*Person{}
 	for _, val := range s.data {
 		for _, comm := range val.Communications {
@@ -66,8 +198,13 @@ func (s *InMemoryPersonStorage) GetPersonsByCommunication(value string) ([]*Pers
 }
 
 func (s *InMemoryPersonStorage) UpdatePerson(person *Person) (*Person, error) {
-	_, err := s.GetPersonByID(person.ID)
-	if err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.data[person.ID]; !ok {
+		return nil, personNotFoundError
+	}
+	if err := s.log.put(person); err != nil {
 		return nil, err
 	}
 	s.data[person.ID] = person
@@ -75,8 +212,14 @@ func (s *InMemoryPersonStorage) UpdatePerson(person *Person) (*Person, error) {
 }
 
 func (s *InMemoryPersonStorage) DeletePerson(id uuid.UUID) (*Person, error) {
-	p, err := s.GetPersonByID(id)
-	if err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.data[id]
+	if !ok {
+		return nil, personNotFoundError
+	}
+	if err := s.log.delete(id); err != nil {
 		return nil, err
 	}
 	delete(s.data, id)
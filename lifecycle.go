@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type shutdownHook struct {
+	name string
+	fn   func(context.Context) error
+}
+
+// Lifecycle owns the servers, background workers and resources of the process.
+// Shutdown runs the registered hooks in reverse order, like defers, so whatever
+// was started last is stopped first: servers drain before workers stop and
+// workers stop before the storage they use is closed.
+type Lifecycle struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks []shutdownHook
+	errc  chan error
+	once  sync.Once
+	err   error
+}
+
+func NewLifecycle(timeout time.Duration) *Lifecycle {
+	return &Lifecycle{timeout: timeout, errc: make(chan error, 1)}
+}
+
+func (l *Lifecycle) OnShutdown(name string, fn func(context.Context) error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, shutdownHook{name, fn})
+}
+
+// Close registers a resource that is closed on shutdown.
+func (l *Lifecycle) Close(name string, close func() error) {
+	l.OnShutdown(name, func(context.Context) error { return close() })
+}
+
+// Go runs a background worker until shutdown cancels its context, then waits for it to return.
+func (l *Lifecycle) Go(name string, worker func(context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		worker(ctx)
+	}()
+
+	l.OnShutdown(name, func(shutdownCtx context.Context) error {
+		cancel()
+		select {
+		case <-done:
+			return nil
+		case <-shutdownCtx.Done():
+			return shutdownCtx.Err()
+		}
+	})
+}
+
+// Serve runs serve in the background and stops it with stop on shutdown.
+// A serve error other than http.ErrServerClosed makes Wait return.
+func (l *Lifecycle) Serve(name string, serve func() error, stop func(context.Context) error) {
+	go func() {
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			select {
+			case l.errc <- fmt.Errorf("%s: %w", name, err):
+			default:
+			}
+		}
+	}()
+	l.OnShutdown(name, stop)
+}
+
+// Wait blocks until SIGINT or SIGTERM arrives or a server fails.
+func (l *Lifecycle) Wait() error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case s := <-sig:
+		log.Info().Str("signal", s.String()).Msg("shutting down")
+		return nil
+	case err := <-l.errc:
+		return err
+	}
+}
+
+// Shutdown runs the hooks once under the lifecycle deadline. A failing hook
+// doesn't stop the following ones; all errors are returned.
+func (l *Lifecycle) Shutdown() error {
+	l.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+		defer cancel()
+
+		l.mu.Lock()
+		hooks := l.hooks
+		l.mu.Unlock()
+
+		var errs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			hook := hooks[i]
+			if err := hook.fn(ctx); err != nil {
+				log.Error().Err(err).Str("hook", hook.name).Msg("shutdown")
+				errs = append(errs, fmt.Errorf("%s: %w", hook.name, err))
+			}
+		}
+		l.err = errors.Join(errs...)
+	})
+	return l.err
+}
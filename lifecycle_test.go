@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLifecycle(t *testing.T) {
+	t.Run("hooks run in reverse order", func(t *testing.T) {
+		lc := NewLifecycle(time.Second)
+		var order []string
+		stopped := false
+
+		lc.Close("storage", func() error {
+			if !stopped {
+				t.Error("storage closed before the worker stopped")
+			}
+			order = append(order, "storage")
+			return nil
+		})
+		lc.Go("worker", func(ctx context.Context) {
+			<-ctx.Done()
+			stopped = true
+		})
+		lc.OnShutdown("server", func(context.Context) error {
+			order = append(order, "server")
+			return errors.New("boom")
+		})
+
+		err := lc.Shutdown()
+		if err == nil || err.Error() != "server: boom" {
+			t.Errorf("err = %v", err)
+		}
+		if !reflect.DeepEqual(order, []string{"server", "storage"}) {
+			t.Errorf("order = %v", order)
+		}
+		if lc.Shutdown() != err {
+			t.Error("second shutdown ran the hooks again")
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		lc := NewLifecycle(50 * time.Millisecond)
+		lc.Go("stuck", func(context.Context) { time.Sleep(time.Second) })
+
+		start := time.Now()
+		if err := lc.Shutdown(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v", err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Error("shutdown didn't respect the deadline")
+		}
+	})
+
+	t.Run("server failure stops waiting", func(t *testing.T) {
+		lc := NewLifecycle(time.Second)
+		lc.Serve("http server", func() error { return errors.New("address already in use") },
+			func(context.Context) error { return nil })
+
+		if err := lc.Wait(); err == nil || err.Error() != "http server: address already in use" {
+			t.Errorf("err = %v", err)
+		}
+	})
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := NewEventBus(eventBufferSize)
+	_, events, cancel := bus.Subscribe(0)
+	defer cancel()
+
+	bus.Close()
+	if _, ok := <-events; ok {
+		t.Error("subscription is still open")
+	}
+	if _, events, _ := bus.Subscribe(0); events != nil {
+		if _, ok := <-events; ok {
+			t.Error("subscribed to a closed bus")
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	LogOutputStdout = "stdout"
+	LogOutputFile   = "file"
+	LogOutputBoth   = "both"
+)
+
+type LogConfig struct {
+	Output     string
+	File       string
+	Level      string
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+func DefaultLogConfig() LogConfig {
+	return LogConfig{
+		Output:     LogOutputStdout,
+		File:       defaultLogFile,
+		Level:      zerolog.LevelInfoValue,
+		MaxSize:    defaultLogMaxSize,
+		MaxAge:     defaultLogMaxAge,
+		MaxBackups: defaultLogMaxBackups,
+	}
+}
+
+// NewLogger builds the process-wide logger. The returned closer releases the log file, if any.
+func NewLogger(cfg LogConfig) (zerolog.Logger, io.Closer, error) {
+	level, err := zerolog.ParseLevel(cfg.Level)
+	if err != nil {
+		return zerolog.Nop(), nil, err
+	}
+
+	var writers []io.Writer
+	var closer io.Closer = ioutil.NopCloser(nil)
+	if cfg.Output == LogOutputStdout || cfg.Output == LogOutputBoth {
+		writers = append(writers, os.Stdout)
+	}
+	if cfg.Output == LogOutputFile || cfg.Output == LogOutputBoth {
+		f, err := newRotatingFile(cfg.File, cfg.MaxSize, cfg.MaxAge, cfg.MaxBackups)
+		if err != nil {
+			return zerolog.Nop(), nil, err
+		}
+		writers = append(writers, f)
+		closer = f
+	}
+	if len(writers) == 0 {
+		return zerolog.Nop(), nil, fmt.Errorf("unknown log output %q", cfg.Output)
+	}
+
+	logger := zerolog.New(zerolog.MultiLevelWriter(writers...)).Level(level).With().Timestamp().Logger()
+	return logger, closer, nil
+}
+
+// rotatingFile is a log file that is moved aside once it grows past maxSize
+// or gets older than maxAge. Only the newest maxBackups rotated files are kept.
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	f       *os.File
+	size    int64
+	created time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("log file path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	rf := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *rotatingFile) Write(b []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+	if rf.size > 0 && rf.due(int64(len(b)), time.Now()) {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(b)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *rotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return nil
+	}
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+func (rf *rotatingFile) due(n int64, now time.Time) bool {
+	if rf.maxSize > 0 && rf.size+n > rf.maxSize {
+		return true
+	}
+	return rf.maxAge > 0 && now.Sub(rf.created) >= rf.maxAge
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.f = f
+	rf.size = info.Size()
+	rf.created = time.Now()
+	if rf.size > 0 {
+		rf.created = info.ModTime()
+	}
+	return nil
+}
+
+func (rf *rotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return err
+	}
+	backup := rf.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(rf.path, backup); err != nil {
+		return err
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	return rf.prune()
+}
+
+// prune removes the oldest backups. Backup names end with a UTC timestamp,
+// so lexical order is chronological order.
+func (rf *rotatingFile) prune() error {
+	if rf.maxBackups <= 0 {
+		return nil
+	}
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return err
+	}
+	sort.Strings(backups)
+	for len(backups) > rf.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// requestID propagates the X-Request-ID header or generates a new one,
+// returns it in the response and attaches a logger carrying it to the request context.
+func (s *Server) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewV4().String()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logCtx := s.logger.With().Str("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			logCtx = logCtx.Str("trace_id", sc.TraceID().String())
+		}
+		logger := logCtx.Logger()
+		next.ServeHTTP(w, r.WithContext(logger.WithContext(r.Context())))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+}
+
+// logging writes a single access log line per request once the response is done.
+func (s *Server) logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Only the head of the body is buffered; the handler still reads the rest
+		// from the connection, so the body size limit keeps working.
+		var buf []byte
+		body := &countingReader{}
+		if r.Body != nil && s.logBody {
+			buf, _ = ioutil.ReadAll(io.LimitReader(r.Body, logBodyCaptureLimit+1))
+			body.r = io.MultiReader(bytes.NewReader(buf), r.Body)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{body, r.Body}
+		}
+
+		lrw := NewLoggingResponseWriter(w, s.logBody)
+		next.ServeHTTP(lrw, r)
+
+		logger := zerolog.Ctx(r.Context())
+		e := logger.Info()
+		if lrw.statusCode >= http.StatusInternalServerError {
+			e = logger.Error()
+		}
+		e = e.Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Int("status", lrw.statusCode).
+			Int64("bytes", lrw.bytes).
+			Dur("latency", time.Since(start)).
+			Str("agent", r.Header.Get("User-Agent"))
+		if s.logBody && len(buf) > logBodyCaptureLimit {
+			// Chunked uploads have no Content-Length, so report what the handler read.
+			e = e.Str("request_body", fmt.Sprintf(redactedBodyMarker, body.n))
+		} else if s.logBody && len(buf) != 0 && isContentTypeJSON(r) {
+			e = e.Str("request_body", s.redactor.Redact(buf))
+		}
+		if s.logBody && lrw.overflow {
+			e = e.Str("response_body", fmt.Sprintf(redactedBodyMarker, lrw.bytes))
+		} else if s.logBody && len(lrw.body) != 0 {
+			e = e.Str("response_body", s.redactor.Redact(lrw.body))
+		}
+		e.Msg("request")
+	})
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	bytes       int64
+	body        []byte
+	captureBody bool
+	overflow    bool
+}
+
+func NewLoggingResponseWriter(w http.ResponseWriter, captureBody bool) *loggingResponseWriter {
+	return &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK, captureBody: captureBody}
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	lrw.statusCode = code
+	lrw.ResponseWriter.WriteHeader(code)
+}
+
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += int64(n)
+	if lrw.captureBody && !lrw.overflow && lrw.Header().Get("Content-Type") == contentTypeJSON {
+		if len(lrw.body)+n > logBodyCaptureLimit {
+			lrw.body, lrw.overflow = nil, true
+		} else {
+			lrw.body = append(lrw.body, b[:n]...)
+		}
+	}
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift the write deadline.
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+// Flush keeps streaming responses such as the event stream working behind the logger.
+func (lrw *loggingResponseWriter) Flush() {
+	if f, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewServer(NewInMemoryPersonStorage(), logBody, WithLogger(zerolog.New(&buf)))
+
+	t.Run("generated request id", func(t *testing.T) {
+		buf.Reset()
+		req, _ := http.NewRequest("GET", "/person", nil)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		id := response.Header().Get(requestIDHeader)
+		if id == "" {
+			t.Fatal("expected a generated request id")
+		}
+		entry := lastLogEntry(t, &buf)
+		if entry["request_id"] != id {
+			t.Errorf("request_id = %v, want %v", entry["request_id"], id)
+		}
+		if entry["status"] != float64(http.StatusNotFound) || entry["method"] != "GET" || entry["path"] != "/person" {
+			t.Errorf("unexpected log entry %v", entry)
+		}
+		if _, ok := entry["latency"]; !ok {
+			t.Error("latency is not logged")
+		}
+		if entry["bytes"] != float64(response.Body.Len()) {
+			t.Errorf("bytes = %v, want %v", entry["bytes"], response.Body.Len())
+		}
+	})
+
+	t.Run("propagated request id", func(t *testing.T) {
+		buf.Reset()
+		req, _ := http.NewRequest("GET", "/person", nil)
+		req.Header.Set(requestIDHeader, "abc-123")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusUnauthorized)
+		if got := response.Header().Get(requestIDHeader); got != "abc-123" {
+			t.Errorf("request id = %q, want abc-123", got)
+		}
+		if entry := lastLogEntry(t, &buf); entry["request_id"] != "abc-123" {
+			t.Errorf("request_id = %v, want abc-123", entry["request_id"])
+		}
+	})
+
+	t.Run("invalid request id is replaced", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "/person", nil)
+		req.Header.Set(requestIDHeader, "bad id\n")
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		if got := response.Header().Get(requestIDHeader); got == "" || got == "bad id\n" {
+			t.Errorf("request id = %q, want a generated one", got)
+		}
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "person_server.log")
+	rf, err := newRotatingFile(path, 10, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := rf.Write([]byte("0123456789")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, _ := filepath.Glob(path + ".*")
+	if len(backups) != 2 {
+		t.Errorf("got %d backups, want 2", len(backups))
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "0123456789" {
+		t.Errorf("current file = %q", data)
+	}
+}
+
+func lastLogEntry(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(lines[len(lines)-1], &entry); err != nil {
+		t.Fatalf("could not decode log line %q: %v", lines[len(lines)-1], err)
+	}
+	return entry
+}
+
+func TestRedactor(t *testing.T) {
+	body := []byte(`[{"id":"02a883a3-13c4-4624-bbba-edc744f69534","name":"Joe","communications":[{"value":"box@mail.ua"},{"value":"+380973224562"}]}]`)
+
+	t.Run("mask", func(t *testing.T) {
+		r, _ := NewRedactor(DefaultRedactionConfig())
+		got := r.Redact(body)
+		want := `[{"communications":[{"value":"***"},{"value":"***"}],"id":"02a883a3-13c4-4624-bbba-edc744f69534","name":"***"}]`
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("keyed hash", func(t *testing.T) {
+		cfg := DefaultRedactionConfig()
+		cfg.Mode = RedactHash
+		cfg.Key = []byte("secret")
+		r, _ := NewRedactor(cfg)
+
+		got := r.Redact(body)
+		if strings.Contains(got, "Joe") || strings.Contains(got, "box@mail.ua") {
+			t.Fatalf("personal data leaked: %s", got)
+		}
+		if got != r.Redact(body) {
+			t.Error("hashes are not stable")
+		}
+
+		cfg.Key = []byte("other")
+		other, _ := NewRedactor(cfg)
+		if got == other.Redact(body) {
+			t.Error("hashes don't depend on the key")
+		}
+	})
+
+	t.Run("hash without key", func(t *testing.T) {
+		cfg := DefaultRedactionConfig()
+		cfg.Mode = RedactHash
+		if _, err := NewRedactor(cfg); err == nil {
+			t.Error("expected an error")
+		}
+	})
+
+	t.Run("unparsable body", func(t *testing.T) {
+		r, _ := NewRedactor(DefaultRedactionConfig())
+		if got := r.Redact([]byte(`{"name":"Joe"`)); strings.Contains(got, "Joe") {
+			t.Errorf("got %s", got)
+		}
+	})
+
+	t.Run("truncation", func(t *testing.T) {
+		cfg := DefaultRedactionConfig()
+		cfg.Mode = RedactNone
+		cfg.MaxBody = 10
+		r, _ := NewRedactor(cfg)
+		got := r.Redact(body)
+		if want := string(body[:10]) + fmt.Sprintf(truncatedBodyMarker, len(body)-10); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+}
+
+func TestRedactedRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewServer(NewInMemoryPersonStorage(), true, WithLogger(zerolog.New(&buf)))
+
+	req, _ := http.NewRequest("POST", "/person", strings.NewReader(
+		`{"id":"02a883a3-13c4-4624-bbba-edc744f69534","name":"Joe","communications":[{"value":"box@mail.ua"}]}`))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	setRequestAuth(req)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, req)
+
+	assertStatus(t, response.Code, http.StatusCreated)
+	entry := lastLogEntry(t, &buf)
+	if entry["request_body"] == nil || entry["response_body"] == nil {
+		t.Fatalf("bodies are not logged: %v", entry)
+	}
+	if strings.Contains(buf.String(), "Joe") || strings.Contains(buf.String(), "box@mail.ua") {
+		t.Errorf("personal data leaked: %s", buf.String())
+	}
+}
+
+func TestRedactedBodyLogging(t *testing.T) {
+	send := func(t *testing.T, server http.Handler, path, body string) *bytes.Buffer {
+		t.Helper()
+		req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentTypeJSON)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		if response.Code >= 300 {
+			t.Fatalf("got status %d: %s", response.Code, response.Body)
+		}
+		return response.Body
+	}
+
+	t.Run("webhook secret", func(t *testing.T) {
+		var buf bytes.Buffer
+		store, _ := NewWebhookStore("")
+		server := NewServer(NewInMemoryPersonStorage(), true, WithLogger(zerolog.New(&buf)),
+			WithWebhooks(NewWebhookDispatcher(store)))
+
+		send(t, server, "/webhooks", `{"url": "http://crm.local/hook"}`)
+
+		sub := store.Subscriptions()[0]
+		if strings.Contains(buf.String(), sub.Secret) {
+			t.Errorf("webhook secret leaked: %s", buf.String())
+		}
+	})
+
+	t.Run("graphql query", func(t *testing.T) {
+		var buf bytes.Buffer
+		server := NewServer(NewInMemoryPersonStorage(), true, WithLogger(zerolog.New(&buf)))
+
+		send(t, server, "/graphql", string(mustMarshal(graphqlRequest{Query: `mutation {
+			addPerson(input: {id: "02a883a3-13c4-4624-bbba-edc744f69534", name: "Joe", communications: [{value: "box@mail.ua"}]}) { id }
+		}`})))
+
+		entry := lastLogEntry(t, &buf)
+		if entry["request_body"] == nil {
+			t.Fatalf("body is not logged: %v", entry)
+		}
+		if strings.Contains(buf.String(), "Joe") || strings.Contains(buf.String(), "box@mail.ua") {
+			t.Errorf("personal data leaked: %s", buf.String())
+		}
+	})
+}
+
+func TestLargeRequestBodyLogging(t *testing.T) {
+	var buf bytes.Buffer
+	server := NewServer(NewInMemoryPersonStorage(), true, WithLogger(zerolog.New(&buf)), WithMaxBodySize(4<<20))
+
+	body := `{"id":"02a883a3-13c4-4624-bbba-edc744f69534","name":"Joe",` + strings.Repeat(" ", 2<<20) + `"communications":[]}`
+	// An unknown length, as with a chunked upload.
+	req, _ := http.NewRequest("POST", "/person", io.MultiReader(strings.NewReader(body)))
+	req.ContentLength = -1
+	req.Header.Set("Content-Type", contentTypeJSON)
+	setRequestAuth(req)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, req)
+
+	assertStatus(t, response.Code, http.StatusCreated)
+	entry := lastLogEntry(t, &buf)
+	if want := fmt.Sprintf(redactedBodyMarker, len(body)); entry["request_body"] != want {
+		t.Errorf("request_body = %v, want %q", entry["request_body"], want)
+	}
+}
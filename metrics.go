@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+const metricsPath = "/metrics"
+
+// Metrics holds the collectors of the service on its own registry.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	storageCalls    *prometheus.CounterVec
+	storageDuration *prometheus.HistogramVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route, method and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		storageCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_calls_total",
+			Help:      "Storage calls by backend, method and result.",
+		}, []string{"backend", "method", "result"}),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "storage_call_duration_seconds",
+			Help:      "Storage call latency by backend and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "method"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration, m.storageCalls, m.storageDuration,
+	)
+	return m
+}
+
+// RegisterCache exports the hit and miss counters of the cache.
+func (m *Metrics) RegisterCache(c *CachingStorage) {
+	m.registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_hits_total",
+			Help:      "Person lookups served from the cache.",
+		}, func() float64 { return float64(c.Stats().Hits) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_misses_total",
+			Help:      "Person lookups that went to the storage.",
+		}, func() float64 { return float64(c.Stats().Misses) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "cache_entries",
+			Help:      "Persons and misses held in the cache.",
+		}, func() float64 { return float64(c.Stats().Entries) }),
+	)
+}
+
+// PersonCounter is implemented by storages that can count their persons without loading them.
+type PersonCounter interface {
+	Count(context.Context) (int, error)
+}
+
+// RegisterPersonCount exports the number of stored persons, counted by the
+// storage on every scrape, so it includes writes made by other replicas.
+func (m *Metrics) RegisterPersonCount(counter PersonCounter) {
+	m.registry.MustRegister(&personCountCollector{
+		desc:    prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "persons"), "Number of stored persons.", nil, nil),
+		counter: counter,
+	})
+}
+
+type personCountCollector struct {
+	desc    *prometheus.Desc
+	counter PersonCounter
+}
+
+func (c *personCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *personCountCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), personCountTimeout)
+	defer cancel()
+	n, err := c.counter.Count(ctx)
+	if err != nil {
+		// Leave the gauge out of this scrape instead of failing the whole scrape.
+		log.Warn().Err(err).Msg("could not count persons")
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// NewAdminHandler serves the operational endpoints on their own port.
+func NewAdminHandler(m *Metrics, h *Health) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, m.Handler())
+	mux.HandleFunc(healthzPath, h.livenessHandler)
+	mux.HandleFunc(readyzPath, h.readinessHandler)
+	return mux
+}
+
+// instrument counts and times requests by the mux pattern they were routed to,
+// so ids in paths don't blow up the label cardinality.
+func (s *Server) instrument(next http.Handler) http.Handler {
+	if s.metrics == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := s.mux.Handler(r)
+		if route == "" {
+			route = "other"
+		}
+
+		lrw := NewLoggingResponseWriter(w, false)
+		next.ServeHTTP(lrw, r)
+
+		status := strconv.Itoa(lrw.statusCode)
+		s.metrics.requests.WithLabelValues(route, r.Method, status).Inc()
+		s.metrics.requestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MetricsStorage measures every call of the wrapped storage.
+type MetricsStorage struct {
+	Storage
+	backend string
+	metrics *Metrics
+}
+
+func NewMetricsStorage(storage Storage, backend string, m *Metrics) *MetricsStorage {
+	return &MetricsStorage{Storage: storage, backend: backend, metrics: m}
+}
+
+func (s *MetricsStorage) WithContext(ctx context.Context) Storage {
+	res := *s
+	res.Storage = storageWithContext(s.Storage, ctx)
+	return &res
+}
+
+func (s *MetricsStorage) observe(method string, start time.Time, err error) {
+	result := "ok"
+	switch {
+	case errors.Is(err, personNotFoundError):
+		result = "not_found"
+	case errors.Is(err, personExistError):
+		result = "exists"
+	case err != nil:
+		result = "error"
+	}
+	s.metrics.storageCalls.WithLabelValues(s.backend, method, result).Inc()
+	s.metrics.storageDuration.WithLabelValues(s.backend, method).Observe(time.Since(start).Seconds())
+}
+
+func (s *MetricsStorage) GetAll() ([]*Person, error) {
+	start := time.Now()
+	pp, err := s.Storage.GetAll()
+	s.observe("GetAll", start, err)
+	return pp, err
+}
+
+func (s *MetricsStorage) Add(p *Person) (*Person, error) {
+	start := time.Now()
+	res, err := s.Storage.Add(p)
+	s.observe("Add", start, err)
+	return res, err
+}
+
+func (s *MetricsStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	start := time.Now()
+	p, err := s.Storage.GetPersonByID(id)
+	s.observe("GetPersonByID", start, err)
+	return p, err
+}
+
+func (s *MetricsStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	start := time.Now()
+	pp, err := s.Storage.GetPersonsByIDs(ids)
+	s.observe("GetPersonsByIDs", start, err)
+	return pp, err
+}
+
+func (s *MetricsStorage) GetPersonsByName(name string) ([]*Person, error) {
+	start := time.Now()
+	pp, err := s.Storage.GetPersonsByName(name)
+	s.observe("GetPersonsByName", start, err)
+	return pp, err
+}
+
+func (s *MetricsStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	start := time.Now()
+	pp, err := s.Storage.GetPersonsByCommunication(value)
+	s.observe("GetPersonsByCommunication", start, err)
+	return pp, err
+}
+
+func (s *MetricsStorage) UpdatePerson(p *Person) (*Person, error) {
+	start := time.Now()
+	res, err := s.Storage.UpdatePerson(p)
+	s.observe("UpdatePerson", start, err)
+	return res, err
+}
+
+func (s *MetricsStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	start := time.Now()
+	p, err := s.Storage.DeletePerson(id)
+	s.observe("DeletePerson", start, err)
+	return p, err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	memory := NewInMemoryPersonStorage()
+	metrics.RegisterPersonCount(memory)
+	server := NewServer(NewMetricsStorage(memory, "memory", metrics), logBody, WithMetrics(metrics, true))
+
+	joe := `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe", "communications": [{"value": "box@mail.ua"}]}`
+	req, _ := http.NewRequest("POST", "/person", strings.NewReader(joe))
+	req.Header.Set("Content-Type", contentTypeJSON)
+	setRequestAuth(req)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/person/02a883a3-13c4-4624-bbba-edc744f69530", nil)
+	setRequestAuth(req)
+	server.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", metricsPath, nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, req)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	body, _ := io.ReadAll(response.Body)
+	for _, want := range []string{
+		`person_service_http_requests_total{method="POST",route="/person",status="201"} 1`,
+		`person_service_http_requests_total{method="GET",route="/person/",status="404"} 1`,
+		`person_service_http_request_duration_seconds_count{method="POST",route="/person",status="201"} 1`,
+		`person_service_storage_calls_total{backend="memory",method="Add",result="ok"} 1`,
+		`person_service_storage_calls_total{backend="memory",method="GetPersonByID",result="not_found"} 1`,
+		`person_service_persons 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics don't contain %q", want)
+		}
+	}
+}
+
+func TestAdminMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	server := NewServer(NewInMemoryPersonStorage(), logBody, WithMetrics(metrics, false))
+
+	req, _ := http.NewRequest("GET", metricsPath, nil)
+	setRequestAuth(req)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, req)
+	assertStatus(t, response.Code, http.StatusNotFound)
+
+	response = httptest.NewRecorder()
+	NewAdminHandler(metrics, NewHealth(healthCheckTimeout)).ServeHTTP(response, req)
+	assertStatus(t, response.Code, http.StatusOK)
+}
+
+type failingCounter struct{}
+
+func (failingCounter) Count(context.Context) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestPersonCountFailure(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.RegisterPersonCount(failingCounter{})
+
+	req, _ := http.NewRequest("GET", metricsPath, nil)
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, req)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	body := response.Body.String()
+	if strings.Contains(body, "person_service_persons ") || !strings.Contains(body, "go_goroutines") {
+		t.Errorf("a failed count should only leave out the person gauge:\n%s", body)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoChangeEvent struct {
+	OperationType string `bson:"operationType"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument *MongoPerson `bson:"fullDocument"`
+}
+
+// WatchEvents follows the persons collection change stream and passes every
+// change to publish until ctx is cancelled. Change streams require a replica set.
+func (s *MongoStorage) WatchEvents(ctx context.Context, publish EventListener) {
+	var resumeToken bson.Raw
+	for {
+		token, err := s.watch(ctx, resumeToken, publish)
+		if token != nil {
+			resumeToken = token
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("mongo: change stream stopped")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *MongoStorage) watch(ctx context.Context, resumeToken bson.Raw, publish EventListener) (bson.Raw, error) {
+	collection := s.client.Database(dbName).Collection(collectionName)
+
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	stream, err := collection.Watch(ctx, bson.D{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var change mongoChangeEvent
+		if err := stream.Decode(&change); err != nil {
+			log.Error().Err(err).Msg("mongo: could not decode change")
+			continue
+		}
+		if e := change.toPersonEvent(); e != nil {
+			publish(e)
+		}
+		resumeToken = stream.ResumeToken()
+	}
+	return resumeToken, stream.Err()
+}
+
+func (c *mongoChangeEvent) toPersonEvent() *PersonEvent {
+	var eventType PersonEventType
+	switch c.OperationType {
+	case "insert":
+		eventType = PersonCreated
+	case "update", "replace":
+		eventType = PersonUpdated
+	case "delete":
+		eventType = PersonDeleted
+	default:
+		return nil
+	}
+
+	p := &Person{ID: uuid.FromStringOrNil(c.DocumentKey.ID)}
+	if c.FullDocument != nil {
+		p = c.FullDocument.toPerson()
+	}
+	return NewPersonEvent(eventType, p)
+}
@@ -6,6 +6,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type MongoStorage struct {
@@ -28,8 +29,23 @@ func NewMongoStorage() (*MongoStorage, error) {
 	return &MongoStorage{client, ctx}, nil
 }
 
-func (s *MongoStorage) Close() {
-	s.client.Disconnect(s.ctx)
+// WithContext returns the storage running its operations under ctx, so they stop at its deadline.
+func (s *MongoStorage) WithContext(ctx context.Context) Storage {
+	return &MongoStorage{s.client, ctx}
+}
+
+func (s *MongoStorage) Close(ctx context.Context) error {
+	return s.client.Disconnect(ctx)
+}
+
+func (s *MongoStorage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx, readpref.Primary())
+}
+
+// Count uses the collection metadata, it doesn't scan the documents.
+func (s *MongoStorage) Count(ctx context.Context) (int, error) {
+	n, err := s.client.Database(dbName).Collection(collectionName).EstimatedDocumentCount(ctx)
+	return int(n), err
 }
 
 func (s *MongoStorage) GetAll() ([]*Person, error) {
@@ -60,11 +76,10 @@ func (s *MongoStorage) Add(p *Person) (*Person, error) {
 
 	collection := s.client.Database(dbName).Collection(collectionName)
 	mp := p.toMongoPerson()
-	res, err := collection.InsertOne(s.ctx, mp)
+	_, err = collection.InsertOne(s.ctx, mp)
 	if err != nil {
 		return nil, err
 	}
-	res = res
 	p, err = s.GetPersonByID(p.ID)
 	return p, nil
 }
@@ -72,7 +87,7 @@ func (s *MongoStorage) Add(p *Person) (*Person, error) {
 func (s *MongoStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
 	collection := s.client.Database(dbName).Collection(collectionName)
 
-	cursor, _ := collection.Find(s.ctx, bson.D{{"_id", id.String()}})
+	cursor, _ := collection.Find(s.ctx, bson.D{{Key: "_id", Value: id.String()}})
 
 	var mps []*MongoPerson
 	err := cursor.All(s.ctx, &mps)
@@ -85,10 +100,33 @@ func (s *MongoStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
 	return mps[0].toPerson(), nil
 }
 
+func (s *MongoStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	collection := s.client.Database(dbName).Collection(collectionName)
+
+	pIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pIds = append(pIds, id.String())
+	}
+	cursor, err := collection.Find(s.ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: pIds}}}})
+	if err != nil {
+		return nil, err
+	}
+
+	mps := []*MongoPerson{}
+	if err := cursor.All(s.ctx, &mps); err != nil {
+		return nil, err
+	}
+	pp := []*Person{}
+	for _, mp := range mps {
+		pp = append(pp, mp.toPerson())
+	}
+	return pp, nil
+}
+
 func (s *MongoStorage) GetPersonsByName(name string) ([]*Person, error) {
 	collection := s.client.Database(dbName).Collection(collectionName)
 
-	cursor, _ := collection.Find(s.ctx, bson.D{{"name", name}})
+	cursor, _ := collection.Find(s.ctx, bson.D{{Key: "name", Value: name}})
 
 	var mps []*MongoPerson
 	err := cursor.All(s.ctx, &mps)
@@ -107,7 +145,7 @@ func (s *MongoStorage) GetPersonsByName(name string) ([]*Person, error) {
 
 func (s *MongoStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
 	collection := s.client.Database(dbName).Collection(collectionName)
-	cursor, _ := collection.Find(s.ctx, bson.D{{"communication.value", value}})
+	cursor, _ := collection.Find(s.ctx, bson.D{{Key: "communication.value", Value: value}})
 
 	mps := []*MongoPerson{}
 	err := cursor.All(s.ctx, &mps)
@@ -132,7 +170,7 @@ func (s *MongoStorage) UpdatePerson(person *Person) (*Person, error) {
 
 	collection := s.client.Database(dbName).Collection(collectionName)
 	mp := person.toMongoPerson()
-	_, err = collection.ReplaceOne(s.ctx, bson.D{{"_id", mp.ID}}, mp)
+	_, err = collection.ReplaceOne(s.ctx, bson.D{{Key: "_id", Value: mp.ID}}, mp)
 	if err != nil {
 		return nil, err
 	}
@@ -147,7 +185,7 @@ func (s *MongoStorage) DeletePerson(id uuid.UUID) (*Person, error) {
 	}
 
 	collection := s.client.Database(dbName).Collection(collectionName)
-	_, err = collection.DeleteOne(s.ctx, bson.D{{"_id", id.String()}})
+	_, err = collection.DeleteOne(s.ctx, bson.D{{Key: "_id", Value: id.String()}})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const (
+	openAPIPath = "/openapi.json"
+	docsPath    = "/docs"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// swaggerUI holds the Swagger UI release the docs page runs, so it works without internet access.
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js swagger-ui/LICENSE
+var swaggerUI embed.FS
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>Person Service API</title>
+	<link rel="stylesheet" href="` + docsPath + `/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="` + docsPath + `/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({url: "` + openAPIPath + `", dom_id: "#swagger-ui"});
+	</script>
+</body>
+</html>`
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.Write(openAPISpec)
+}
+
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+// docsAssetsHandler serves the files the docs page loads.
+func docsAssetsHandler() http.Handler {
+	assets, _ := fs.Sub(swaggerUI, "swagger-ui")
+	files := http.StripPrefix(docsPath+"/", http.FileServer(http.FS(assets)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type openAPIDoc map[string]interface{}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	store, _ := NewWebhookStore("")
+	server := NewServer(NewInMemoryPersonStorage(), logBody,
+		WithEventBus(NewEventBus(eventBufferSize)), WithWebhooks(NewWebhookDispatcher(store)),
+		WithHealth(NewHealth(healthCheckTimeout)), WithMetrics(NewMetrics(), true))
+	paths := doc["paths"].(map[string]interface{})
+
+	for _, route := range server.routes {
+		documented := false
+		for path := range paths {
+			if path == route || strings.HasSuffix(route, "/") && strings.HasPrefix(path, route) && strings.Contains(path, "{") {
+				documented = true
+				break
+			}
+		}
+		if !documented {
+			t.Errorf("route %q is not documented in %s", route, openAPIPath)
+		}
+	}
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	doc := loadOpenAPI(t)
+	server := NewServer(NewInMemoryPersonStorage(), logBody)
+	joe := `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe", "communications": [{"value": "box@mail.ua"}]}`
+
+	requests := []struct {
+		method, path, body string
+		auth               bool
+	}{
+		{"GET", "/person", "", true},
+		{"GET", "/person", "", false},
+		{"POST", "/person", joe, true},
+		{"POST", "/person", joe, true},
+		{"POST", "/person", `{"name": "Joe"}`, true},
+		{"PUT", "/person", joe, true},
+		{"GET", "/person", "", true},
+		{"GET", "/person?name=Louis", "", true},
+		{"GET", "/person/02a883a3-13c4-4624-bbba-edc744f69534", "", true},
+		{"GET", "/person/123", "", true},
+		{"DELETE", "/person/02a883a3-13c4-4624-bbba-edc744f69534", "", true},
+		{"DELETE", "/person/02a883a3-13c4-4624-bbba-edc744f69534", "", true},
+		{"GET", "/openapi.json", "", false},
+	}
+
+	for _, tt := range requests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.auth {
+			setRequestAuth(req)
+		}
+		if tt.body != "" {
+			req.Header.Add("Content-Type", contentTypeJSON)
+		}
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		if err := doc.validateResponse(req, response); err != nil {
+			t.Errorf("%s %s: %v", tt.method, tt.path, err)
+		}
+	}
+}
+
+func TestDocs(t *testing.T) {
+	server := NewServer(NewInMemoryPersonStorage(), logBody)
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	page := get(docsPath)
+	assertStatus(t, page.Code, http.StatusOK)
+	if body := page.Body.String(); strings.Contains(body, "https://") {
+		t.Errorf("docs page loads assets from elsewhere:\n%s", body)
+	}
+
+	for path, contentType := range map[string]string{
+		docsPath + "/swagger-ui.css":       "text/css",
+		docsPath + "/swagger-ui-bundle.js": "text/javascript",
+	} {
+		response := get(path)
+		assertStatus(t, response.Code, http.StatusOK)
+		if got := response.Header().Get("Content-Type"); !strings.HasPrefix(got, contentType) {
+			t.Errorf("%s: Content-Type = %q, want %q", path, got, contentType)
+		}
+		if !strings.Contains(page.Body.String(), path) {
+			t.Errorf("docs page doesn't load %s", path)
+		}
+	}
+	assertStatus(t, get(docsPath+"/openapi.go").Code, http.StatusNotFound)
+}
+
+func (doc openAPIDoc) validateResponse(req *http.Request, response *httptest.ResponseRecorder) error {
+	operation, err := doc.operation(req.Method, req.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	responses := operation["responses"].(map[string]interface{})
+	spec, ok := responses[strconv.Itoa(response.Code)]
+	if !ok {
+		return fmt.Errorf("status %d is not documented", response.Code)
+	}
+	content, ok := doc.resolve(spec)["content"].(map[string]interface{})
+	if !ok {
+		if response.Body.Len() != 0 {
+			return fmt.Errorf("status %d is documented without a body, got %q", response.Code, response.Body.String())
+		}
+		return nil
+	}
+
+	media, ok := content[contentTypeJSON].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var body interface{}
+	if err := json.Unmarshal(response.Body.Bytes(), &body); err != nil {
+		return fmt.Errorf("status %d: %v", response.Code, err)
+	}
+	return doc.validate(media["schema"], body, "body")
+}
+
+func (doc openAPIDoc) operation(method, path string) (map[string]interface{}, error) {
+	paths := doc["paths"].(map[string]interface{})
+
+	// Literal paths win over templates, like /person/events over /person/{id}.
+	item, ok := paths[path]
+	if !ok {
+		for template, v := range paths {
+			pattern := "^" + regexp.MustCompile(`\{[^}]+\}`).ReplaceAllString(template, "[^/]+") + "$"
+			if regexp.MustCompile(pattern).MatchString(path) {
+				item = v
+				break
+			}
+		}
+	}
+	if item == nil {
+		return nil, fmt.Errorf("path is not documented")
+	}
+
+	operation, ok := item.(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("method is not documented")
+	}
+	return operation, nil
+}
+
+func (doc openAPIDoc) resolve(v interface{}) map[string]interface{} {
+	m := v.(map[string]interface{})
+	ref, ok := m["$ref"].(string)
+	if !ok {
+		return m
+	}
+
+	var node interface{} = map[string]interface{}(doc)
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		node = node.(map[string]interface{})[part]
+	}
+	return doc.resolve(node)
+}
+
+// validate checks the subset of JSON Schema used by openapi.json.
+func (doc openAPIDoc) validate(schemaValue, v interface{}, at string) error {
+	schema := doc.resolve(schemaValue)
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, s := range oneOf {
+			if doc.validate(s, v, at) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s matches %d oneOf schemas", at, matches)
+		}
+		return nil
+	}
+
+	if types, ok := schema["type"]; ok {
+		if err := validateType(types, v, at); err != nil {
+			return err
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if e == v {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, v, enum)
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, name := range toStrings(schema["required"]) {
+			if _, ok := value[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		props, _ := schema["properties"].(map[string]interface{})
+		for name, prop := range props {
+			if pv, ok := value[name]; ok {
+				if err := doc.validate(prop, pv, at+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"]; ok {
+			for i, item := range value {
+				if err := doc.validate(items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		if schema["format"] == "uuid" && uuid.FromStringOrNil(value) == uuid.Nil {
+			return fmt.Errorf("%s: %q is not a uuid", at, value)
+		}
+		if minLength, ok := schema["minLength"].(float64); ok && len(value) < int(minLength) {
+			return fmt.Errorf("%s: %q is too short", at, value)
+		}
+	}
+	return nil
+}
+
+func validateType(types, v interface{}, at string) error {
+	allowed := toStrings(types)
+	if s, ok := types.(string); ok {
+		allowed = []string{s}
+	}
+
+	var got string
+	switch v.(type) {
+	case nil:
+		got = "null"
+	case map[string]interface{}:
+		got = "object"
+	case []interface{}:
+		got = "array"
+	case string:
+		got = "string"
+	case bool:
+		got = "boolean"
+	case float64:
+		got = "number"
+	}
+
+	for _, t := range allowed {
+		if t == got || t == "integer" && got == "number" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: got %s, want %v", at, got, allowed)
+}
+
+func toStrings(v interface{}) []string {
+	list, _ := v.([]interface{})
+	ss := make([]string, 0, len(list))
+	for _, item := range list {
+		ss = append(ss, item.(string))
+	}
+	return ss
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+const outboxSchema = `
+	CREATE TABLE IF NOT EXISTS person_outbox (
+		id            BIGSERIAL PRIMARY KEY,
+		event_id      UUID        NOT NULL,
+		person_id     UUID        NOT NULL,
+		type          TEXT        NOT NULL,
+		payload       JSONB       NOT NULL,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+		dispatched_at TIMESTAMPTZ
+	);
+	CREATE INDEX IF NOT EXISTS person_outbox_pending ON person_outbox (id) WHERE dispatched_at IS NULL;`
+
+// Publisher delivers outbox events to the outside world.
+type Publisher interface {
+	Publish(context.Context, *PersonEvent) error
+}
+
+// WriterPublisher writes every event as a JSON line, e.g. to stdout or a file.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+func (p *WriterPublisher) Publish(_ context.Context, e *PersonEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return json.NewEncoder(p.w).Encode(e)
+}
+
+// EnableOutbox creates the outbox table and makes every write record its
+// event in the same transaction as the person rows.
+func (s *PostgresStorage) EnableOutbox() error {
+	if _, err := s.db.Exec(outboxSchema); err != nil {
+		return err
+	}
+	s.outbox = true
+	return nil
+}
+
+func (s *PostgresStorage) writeOutbox(tx *sqlx.Tx, e *PersonEvent) error {
+	if !s.outbox {
+		return nil
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(s.ctx, `INSERT INTO person_outbox (event_id, person_id, type, payload) VALUES ($1, $2, $3, $4)`,
+		e.ID.String(), e.PersonID.String(), string(e.Type), string(payload))
+	if err != nil {
+		return err
+	}
+	// The notification is only delivered on commit, so the relay never wakes up for a rolled back write.
+	_, err = tx.ExecContext(s.ctx, `SELECT pg_notify($1, '')`, outboxChannel)
+	return err
+}
+
+// OutboxRelay moves outbox rows to a Publisher. Rows are published in id order
+// and marked dispatched only after a successful publish, so every event is
+// delivered at least once and in order per person.
+type OutboxRelay struct {
+	db           *sqlx.DB
+	publisher    Publisher
+	batchSize    int
+	pollInterval time.Duration
+}
+
+func NewOutboxRelay(s *PostgresStorage, publisher Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		db:           s.db,
+		publisher:    publisher,
+		batchSize:    outboxBatchSize,
+		pollInterval: outboxPollInterval,
+	}
+}
+
+// Run relays events until ctx is cancelled. It wakes up on outbox
+// notifications and falls back to polling every pollInterval.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for {
+		err := r.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("outbox: relay stopped")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+func (r *OutboxRelay) run(ctx context.Context) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+outboxChannel); err != nil {
+			return err
+		}
+
+		for {
+			if err := r.drain(ctx); err != nil {
+				return err
+			}
+
+			waitCtx, cancel := context.WithTimeout(ctx, r.pollInterval)
+			_, err := pgConn.WaitForNotification(waitCtx)
+			cancel()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil && waitCtx.Err() == nil {
+				return err
+			}
+		}
+	})
+}
+
+// drain relays batches until the outbox has no more pending events or a publish fails.
+func (r *OutboxRelay) drain(ctx context.Context) error {
+	for {
+		n, err := r.relayBatch(ctx)
+		if err != nil || n < r.batchSize {
+			return err
+		}
+	}
+}
+
+type outboxRow struct {
+	ID      int64  `db:"id"`
+	Payload []byte `db:"payload"`
+}
+
+// relayBatch publishes up to batchSize pending events and returns how many were dispatched.
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Only one relay may work at a time, otherwise events of a person could overtake each other.
+	var locked bool
+	if err := tx.GetContext(ctx, &locked, `SELECT pg_try_advisory_xact_lock($1)`, outboxLockID); err != nil || !locked {
+		return 0, err
+	}
+
+	var rows []*outboxRow
+	err = tx.SelectContext(ctx, &rows, `
+		SELECT id, payload
+		FROM person_outbox
+		WHERE dispatched_at IS NULL
+		ORDER BY id
+		LIMIT $1`, r.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	for _, row := range rows {
+		e := &PersonEvent{}
+		if err := json.Unmarshal(row.Payload, e); err != nil {
+			return 0, err
+		}
+		if err := r.publisher.Publish(ctx, e); err != nil {
+			// Stop here so later events of the same person are not published out of order.
+			log.Error().Err(err).Str("event_id", e.ID.String()).Msg("outbox: could not publish event")
+			break
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE person_outbox SET dispatched_at = now() WHERE id = $1`, row.ID); err != nil {
+			return 0, err
+		}
+		dispatched++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return dispatched, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	uuid "github.com/satori/go.uuid"
+)
+
+func TestOutboxWrite(t *testing.T) {
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe", Communications: []*Communication{{"box@mail.ua"}}}
+
+	t.Run("event is written in the person transaction", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO person `).WithArgs(joe.ID.String(), "Joe").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO communication `).WithArgs("box@mail.ua", joe.ID.String()).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO person_outbox `).
+			WithArgs(sqlmock.AnyArg(), joe.ID.String(), string(PersonCreated), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(`SELECT pg_notify`).WithArgs(outboxChannel).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectQuery(`SELECT \* FROM person WHERE id`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(joe.ID.String(), "Joe"))
+		mock.ExpectQuery(`(?i)FROM communication`).
+			WillReturnRows(sqlmock.NewRows([]string{"personid", "value"}).AddRow(joe.ID.String(), "box@mail.ua"))
+
+		if _, err := s.Add(joe); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("failed outbox write rolls the person back", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO person `).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO communication `).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO person_outbox `).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+
+		if _, err := s.Add(joe); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+}
+
+// recordingPublisher records the published events and fails once for the events in failOnce.
+type recordingPublisher struct {
+	published []uuid.UUID
+	failOnce  map[uuid.UUID]bool
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, e *PersonEvent) error {
+	if p.failOnce[e.ID] {
+		delete(p.failOnce, e.ID)
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func TestOutboxRelay(t *testing.T) {
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe"}
+	events := []*PersonEvent{
+		NewPersonEvent(PersonCreated, joe),
+		NewPersonEvent(PersonUpdated, joe),
+		NewPersonEvent(PersonDeleted, joe),
+	}
+	rows := func(ids ...int) *sqlmock.Rows {
+		rows := sqlmock.NewRows([]string{"id", "payload"})
+		for _, id := range ids {
+			payload, _ := json.Marshal(events[id-1])
+			rows.AddRow(int64(id), payload)
+		}
+		return rows
+	}
+	expectBatch := func(mock sqlmock.Sqlmock, pending *sqlmock.Rows, dispatched ...int) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WithArgs(outboxLockID).
+			WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+		mock.ExpectQuery(`FROM person_outbox`).WithArgs(2).WillReturnRows(pending)
+		for _, id := range dispatched {
+			mock.ExpectExec(`UPDATE person_outbox SET dispatched_at`).WithArgs(int64(id)).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+	}
+
+	t.Run("publishes in order and retries after a failure", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		publisher := &recordingPublisher{failOnce: map[uuid.UUID]bool{events[1].ID: true}}
+		relay := NewOutboxRelay(s, publisher)
+		relay.batchSize = 2
+
+		// The second event fails, so the batch stops there and the third waits behind it.
+		expectBatch(mock, rows(1, 2), 1)
+		if err := relay.drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		// The next round starts over at the failed event; a full batch is followed by another one.
+		expectBatch(mock, rows(2, 3), 2, 3)
+		expectBatch(mock, rows())
+		if err := relay.drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		want := []uuid.UUID{events[0].ID, events[1].ID, events[2].ID}
+		if len(publisher.published) != len(want) {
+			t.Fatalf("published %v, want %v", publisher.published, want)
+		}
+		for i := range want {
+			if publisher.published[i] != want[i] {
+				t.Errorf("published %v, want %v", publisher.published, want)
+			}
+		}
+	})
+
+	t.Run("waits while another relay holds the lock", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		publisher := &recordingPublisher{}
+		relay := NewOutboxRelay(s, publisher)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT pg_try_advisory_xact_lock`).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+		mock.ExpectRollback()
+		if err := relay.drain(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if len(publisher.published) != 0 {
+			t.Errorf("published %v without the lock", publisher.published)
+		}
+	})
+}
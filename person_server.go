@@ -1,28 +1,105 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"encoding/xml"
+	"errors"
 	"github.com/go-http-utils/headers"
+	graphql "github.com/graph-gophers/graphql-go"
 	"github.com/rs/zerolog"
 	uuid "github.com/satori/go.uuid"
-	"io/ioutil"
 	"net/http"
-	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 )
 
 type Server struct {
 	storage Storage
 	http.Handler
-	logBody bool
+	logBody            bool
+	logger             zerolog.Logger
+	redactor           *Redactor
+	metrics            *Metrics
+	metricsEndpoint    bool
+	health             *Health
+	rateLimiter        RateLimiter
+	rateLimits         RateLimitConfig
+	maxBodySize        int64
+	compressionMinSize int
+	corsPolicy         *CORS
+	webhooks           *WebhookDispatcher
+	events             *EventBus
+	graphql            *graphql.Schema
+	mux                *http.ServeMux
+	routes             []string
+}
+
+type ServerOption func(*Server)
+
+func WithEventBus(bus *EventBus) ServerOption {
+	return func(s *Server) {
+		s.events = bus
+	}
+}
+
+// WithRedactor sets how bodies are scrubbed when logBody is on. Names and
+// communication values are masked by default.
+func WithRedactor(r *Redactor) ServerOption {
+	return func(s *Server) {
+		s.redactor = r
+	}
+}
+
+// WithMetrics instruments every request. With endpoint set the metrics are
+// also served on /metrics, otherwise they are expected on the admin port.
+func WithMetrics(m *Metrics, endpoint bool) ServerOption {
+	return func(s *Server) {
+		s.metrics = m
+		s.metricsEndpoint = endpoint
+	}
+}
+
+// WithHealth serves the liveness and readiness probes. They are not authenticated.
+func WithHealth(h *Health) ServerOption {
+	return func(s *Server) {
+		s.health = h
+	}
+}
+
+// WithRateLimiter limits requests per user and per client IP. Zero limits disable limiting.
+func WithRateLimiter(limiter RateLimiter, limits RateLimitConfig) ServerOption {
+	return func(s *Server) {
+		s.rateLimiter = limiter
+		s.rateLimits = limits
+	}
+}
+
+// WithMaxBodySize limits the size of request bodies; larger ones get 413.
+func WithMaxBodySize(n int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// WithLogger sets the logger requests are logged with. Nothing is logged by default.
+func WithLogger(logger zerolog.Logger) ServerOption {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+func WithWebhooks(d *WebhookDispatcher) ServerOption {
+	return func(s *Server) {
+		s.webhooks = d
+	}
 }
 
 type Storage interface {
 	GetAll() ([]*Person, error)
 	Add(*Person) (*Person, error)
 	GetPersonByID(uuid.UUID) (*Person, error)
+	GetPersonsByIDs([]uuid.UUID) ([]*Person, error)
 	GetPersonsByName(string) ([]*Person, error)
 	GetPersonsByCommunication(string) ([]*Person, error)
 	UpdatePerson(*Person) (*Person, error)
@@ -30,27 +107,67 @@ type Storage interface {
 }
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	XMLName xml.Name `json:"-" xml:"error" yaml:"-" msgpack:"-"`
+	Error   string   `json:"error" xml:",chardata" yaml:"error" msgpack:"error"`
 }
 
-func NewServer(storage Storage, logBody bool) *Server {
-	server := &Server{storage: storage, logBody: logBody}
+func NewServer(storage Storage, logBody bool, opts ...ServerOption) *Server {
+	server := &Server{storage: storage, logBody: logBody, logger: zerolog.Nop(), maxBodySize: defaultMaxBodySize,
+		compressionMinSize: defaultCompressionMinSize}
+	server.graphql = graphql.MustParseSchema(graphqlSchema, &graphqlResolver{storage})
+	server.redactor, _ = NewRedactor(DefaultRedactionConfig())
+	for _, opt := range opts {
+		opt(server)
+	}
 
-	mux := http.NewServeMux()
-	personHandler := server.requestAuthentication(server.logging(http.HandlerFunc(server.personHandler)))
-	mux.Handle("/person", personHandler)
-	mux.Handle("/person/", personHandler)
+	server.mux = http.NewServeMux()
+	personHandler := server.requestAuthentication(traced("personHandler", server.personHandler))
+	server.handle("/person", personHandler)
+	server.handle("/person/", personHandler)
+	server.handle(graphqlPath, server.requestAuthentication(traced("graphqlHandler", server.graphqlHandler)))
+	server.handle(openAPIPath, http.HandlerFunc(openAPIHandler))
+	server.handle(docsPath, http.HandlerFunc(docsHandler))
+	server.handle(docsPath+"/", docsAssetsHandler())
+	if server.health != nil {
+		server.handle(healthzPath, http.HandlerFunc(server.health.livenessHandler))
+		server.handle(readyzPath, http.HandlerFunc(server.health.readinessHandler))
+	}
+	if server.metrics != nil && server.metricsEndpoint {
+		server.handle(metricsPath, server.metrics.Handler())
+	}
+
+	if server.events != nil {
+		server.handle(eventsPath, server.requestAuthentication(traced("eventsHandler", server.eventsHandler)))
+	}
 
-	server.Handler = mux
+	if server.webhooks != nil {
+		webhookHandler := server.requestAuthentication(traced("webhookHandler", server.webhookHandler))
+		server.handle(webhooksPath, webhookHandler)
+		server.handle(webhooksPath+"/", webhookHandler)
+	}
+
+	server.Handler = server.tracing(server.requestID(server.compression(server.logging(server.instrument(server.cors(server.rateLimiting(server.mux)))))))
 
 	return server
 }
 
+func (s *Server) storageFor(r *http.Request) Storage {
+	return storageWithContext(s.storage, r.Context())
+}
+
+// handle registers the handler on the server mux and records the pattern for the API documentation checks.
+func (s *Server) handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+	s.routes = append(s.routes, pattern)
+}
+
 func (s *Server) requestAuthentication(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		username, password, ok := r.BasicAuth()
+		_, span := tracer.Start(r.Context(), "requestAuthentication")
+		_, ok := requestIdentity(r)
+		span.End()
 
-		if !ok || username != authLogin || password != authPassword {
+		if !ok {
 			w.WriteHeader(http.StatusUnauthorized)
 		} else {
 			next.ServeHTTP(w, r)
@@ -58,41 +175,14 @@ func (s *Server) requestAuthentication(next http.Handler) http.Handler {
 	})
 }
 
-func (s *Server) logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger, f := getServiceLogger("person_server")
-		if logger == nil {
-			next.ServeHTTP(w, r)
-			return
-		}
-		defer f.Close()
-
-		var buf []byte
-		if r.Body != nil {
-			buf, _ = ioutil.ReadAll(r.Body)
-			r.Body = ioutil.NopCloser(bytes.NewBuffer(buf))
-		}
-
-		f.WriteString("\n")
-		e := logger.Info().Time("time", time.Now()).Bytes("method", []byte(r.Method)).Bytes("path", []byte(r.URL.Path)).Bytes("agent", []byte(r.Header.Get("User-Agent")))
-		if r.Body != nil && isContentTypeJSON(r) && s.logBody {
-			e.Bytes("body", buf)
-		}
-		e.Send()
-
-		lrw := NewLoggingResponseWriter(w)
-		next.ServeHTTP(lrw, r)
-
-		e = logger.Info().Time("time", time.Now()).Int("status", lrw.statusCode)
-		if lrw.body != nil && s.logBody {
-			e.Bytes("body", lrw.body)
-		}
-		e.Send()
-	})
+func authenticate(username, password string) bool {
+	return username == authLogin && password == authPassword
 }
 
 func (s *Server) personHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", contentTypeJSON)
+	if !negotiate(w, r) {
+		return
+	}
 
 	switch r.Method {
 	case http.MethodGet:
@@ -109,18 +199,23 @@ func (s *Server) personHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) addPerson(w http.ResponseWriter, r *http.Request) {
-	if !isContentTypeJSON(r) {
+	codec, ok := codecs.ForContentType(r.Header.Get(headers.ContentType))
+	if !ok {
 		handleError(wrongContentTypeError, w, http.StatusUnsupportedMediaType)
 		return
 	}
 
 	p := &Person{}
-	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+	if err := s.decodeBody(w, r, codec, p); err != nil {
+		handleError(err, w, decodeStatus(err))
+		return
+	}
+	if err := p.Validate(); err != nil {
 		handleError(err, w, http.StatusBadRequest)
 		return
 	}
 
-	addedPerson, err := s.storage.Add(p)
+	addedPerson, err := s.storageFor(r).Add(p)
 	if err == personExistError {
 		handleError(err, w, http.StatusUnprocessableEntity)
 		return
@@ -129,7 +224,7 @@ func (s *Server) addPerson(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(addedPerson)
+	encodeBody(w, addedPerson)
 }
 
 func (s *Server) getPersons(w http.ResponseWriter, r *http.Request) {
@@ -139,88 +234,73 @@ func (s *Server) getPersons(w http.ResponseWriter, r *http.Request) {
 			handleError(err, w, http.StatusBadRequest)
 			return
 		}
-		p, err := s.storage.GetPersonByID(id)
+		p, err := s.storageFor(r).GetPersonByID(id)
 		if err == personNotFoundError {
 			handleError(err, w, http.StatusNotFound)
 			return
 		} else if err != nil {
-			handleError(err, nil, http.StatusInternalServerError)
+			handleError(err, w, http.StatusInternalServerError)
 			return
 		}
-		json.NewEncoder(w).Encode(p)
+		encodeBody(w, p)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	ppName := []*Person{}
-	ppComm := []*Person{}
-
-	if name := getQueryParam(r, "name"); name != "" {
-		pName, err := s.storage.GetPersonsByName(name)
-		if err == nil {
-			ppName = append(ppName, pName...)
-		} else if err != personNotFoundError {
-			handleError(err, w, http.StatusInternalServerError)
-			return
-		}
-	}
-	if communication := getQueryParam(r, "communication"); communication != "" {
-		pName, err := s.storage.GetPersonsByCommunication(communication)
-		if err == nil {
-			ppComm = append(ppComm, pName...)
-		} else if err != personNotFoundError {
-			handleError(err, w, http.StatusInternalServerError)
-			return
+	query := r.URL.Query()
+	query.Del("limit")
+	query.Del("after")
+
+	var pp []*Person
+	var err error
+	if len(query) != 0 {
+		pp, err = searchPersons(r.Context(), s.storage, getQueryParam(r, "name"), getQueryParam(r, "communication"))
+	} else {
+		pp, err = s.storageFor(r).GetAll()
+		if err == nil && len(pp) == 0 {
+			err = personNotFoundError
 		}
 	}
-
-	if len(r.URL.Query()) != 0 {
-		var pp []*Person
-		if len(ppName) != 0 && len(ppComm) != 0 {
-			pp = exceptPersons(ppName, ppComm)
-		} else if len(ppName) != 0 {
-			pp = ppName
-		} else if len(ppComm) != 0 {
-			pp = ppComm
-		}
-		if len(pp) == 0 {
-			handleError(personNotFoundError, w, http.StatusNotFound)
-			return
-		}
-		json.NewEncoder(w).Encode(pp)
-		w.WriteHeader(http.StatusOK)
+	if err == personNotFoundError {
+		handleError(err, w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		handleError(err, w, http.StatusInternalServerError)
 		return
 	}
 
-	ps, err := s.storage.GetAll()
+	pp, next, err := paginatePersons(pp, getQueryParam(r, "limit"), getQueryParam(r, "after"))
 	if err != nil {
-		handleError(err, w, http.StatusInternalServerError)
-		return
-	} else if len(ps) == 0 {
-		handleError(personNotFoundError, w, http.StatusNotFound)
+		handleError(err, w, http.StatusBadRequest)
 		return
 	}
-	json.NewEncoder(w).Encode(ps)
-	w.WriteHeader(http.StatusOK)
-	return
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+	encodeBody(w, pp)
 }
 
 func (s *Server) putPerson(w http.ResponseWriter, r *http.Request) {
-	if !isContentTypeJSON(r) {
+	codec, ok := codecs.ForContentType(r.Header.Get(headers.ContentType))
+	if !ok {
 		handleError(wrongContentTypeError, w, http.StatusUnsupportedMediaType)
 		return
 	}
 
 	p := &Person{}
-	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+	if err := s.decodeBody(w, r, codec, p); err != nil {
+		handleError(err, w, decodeStatus(err))
+		return
+	}
+	if err := p.Validate(); err != nil {
 		handleError(err, w, http.StatusBadRequest)
 		return
 	}
 
-	p2, err := s.storage.UpdatePerson(p)
+	p2, err := s.storageFor(r).UpdatePerson(p)
 	if err == personNotFoundError {
-		p2, err = s.storage.Add(p)
-		json.NewEncoder(w).Encode(p2)
+		p2, err = s.storageFor(r).Add(p)
+		encodeBody(w, p2)
 		w.WriteHeader(http.StatusOK)
 		return
 	}
@@ -228,7 +308,7 @@ func (s *Server) putPerson(w http.ResponseWriter, r *http.Request) {
 		handleError(err, w, http.StatusInternalServerError)
 		return
 	}
-	json.NewEncoder(w).Encode(p2)
+	encodeBody(w, p2)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -240,7 +320,7 @@ func (s *Server) deletePerson(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err = s.storage.DeletePerson(id)
+		_, err = s.storageFor(r).DeletePerson(id)
 		if err == personNotFoundError {
 			handleError(err, w, http.StatusNotFound)
 		} else if err != nil {
@@ -255,8 +335,13 @@ func (s *Server) deletePerson(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleError(err error, w http.ResponseWriter, status int) {
+	var circuitOpen *CircuitOpenError
+	if errors.As(err, &circuitOpen) {
+		w.Header().Set(headers.RetryAfter, ceilSeconds(circuitOpen.RetryAfter))
+		status = http.StatusServiceUnavailable
+	}
 	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{err.Error()})
+	encodeBody(w, ErrorResponse{Error: err.Error()})
 }
 
 func isContentTypeJSON(r *http.Request) bool {
@@ -273,40 +358,70 @@ func getQueryParam(r *http.Request, paramName string) string {
 	return ""
 }
 
-func getServiceLogger(name string) (*zerolog.Logger, *os.File) {
-	const folder = "logs"
+// searchPersons looks persons up by name and communication. When both match,
+// only persons found by both are returned.
+func searchPersons(ctx context.Context, storage Storage, name, communication string) ([]*Person, error) {
+	ctx, span := tracer.Start(ctx, "searchPersons")
+	defer span.End()
+	storage = storageWithContext(storage, ctx)
 
-	if err := os.Mkdir(folder, os.FileMode(0755)); err != nil && !os.IsExist(err) {
-		return nil, nil
-	}
+	ppName := []*Person{}
+	ppComm := []*Person{}
 
-	f, err := os.OpenFile(folder+"/"+name+".log",
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, nil
+	if name != "" {
+		pName, err := storage.GetPersonsByName(name)
+		if err == nil {
+			ppName = append(ppName, pName...)
+		} else if err != personNotFoundError {
+			return nil, err
+		}
+	}
+	if communication != "" {
+		pComm, err := storage.GetPersonsByCommunication(communication)
+		if err == nil {
+			ppComm = append(ppComm, pComm...)
+		} else if err != personNotFoundError {
+			return nil, err
+		}
 	}
-	mainLogger := zerolog.New(f).With().Logger()
-	return &mainLogger, f
-}
-
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-	body       []byte
-}
 
-func NewLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
-	return &loggingResponseWriter{w, http.StatusOK, nil}
+	var pp []*Person
+	if len(ppName) != 0 && len(ppComm) != 0 {
+		_, merge := tracer.Start(ctx, "exceptPersons")
+		pp = exceptPersons(ppName, ppComm)
+		merge.End()
+	} else if len(ppName) != 0 {
+		pp = ppName
+	} else if len(ppComm) != 0 {
+		pp = ppComm
+	}
+	if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+	return pp, nil
 }
 
-func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
-	lrw.ResponseWriter.WriteHeader(code)
-}
+// paginatePersons returns at most limit persons ordered by id that follow the
+// after id, plus the cursor of the next page. Without a limit all persons are returned.
+func paginatePersons(pp []*Person, limitStr, after string) ([]*Person, string, error) {
+	if limitStr == "" {
+		return pp, "", nil
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return nil, "", invalidLimitError
+	}
 
-func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
-	lrw.body = append(lrw.body, b...)
-	return lrw.ResponseWriter.Write(b)
+	sort.Slice(pp, func(i, j int) bool { return pp[i].ID.String() < pp[j].ID.String() })
+	start := 0
+	if after != "" {
+		start = sort.Search(len(pp), func(i int) bool { return pp[i].ID.String() > after })
+	}
+	end := start + limit
+	if end >= len(pp) {
+		return pp[start:], "", nil
+	}
+	return pp[start:end], pp[end-1].ID.String(), nil
 }
 
 func exceptPersons(p1 []*Person, p2 []*Person) []*Person {
@@ -0,0 +1,540 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: personpb/person.proto
+
+package personpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Communication struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Value         string                 `protobuf:"bytes,1,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Communication) Reset() {
+	*x = Communication{}
+	mi := &file_personpb_person_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Communication) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Communication) ProtoMessage() {}
+
+func (x *Communication) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Communication.ProtoReflect.Descriptor instead.
+func (*Communication) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Communication) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+type Person struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name           string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Communications []*Communication       `protobuf:"bytes,3,rep,name=communications,proto3" json:"communications,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Person) Reset() {
+	*x = Person{}
+	mi := &file_personpb_person_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Person) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Person) ProtoMessage() {}
+
+func (x *Person) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Person.ProtoReflect.Descriptor instead.
+func (*Person) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Person) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Person) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Person) GetCommunications() []*Communication {
+	if x != nil {
+		return x.Communications
+	}
+	return nil
+}
+
+type CreateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Person        *Person                `protobuf:"bytes,1,opt,name=person,proto3" json:"person,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateRequest) Reset() {
+	*x = CreateRequest{}
+	mi := &file_personpb_person_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateRequest) ProtoMessage() {}
+
+func (x *CreateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateRequest.ProtoReflect.Descriptor instead.
+func (*CreateRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CreateRequest) GetPerson() *Person {
+	if x != nil {
+		return x.Person
+	}
+	return nil
+}
+
+type GetRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRequest) Reset() {
+	*x = GetRequest{}
+	mi := &file_personpb_person_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRequest) ProtoMessage() {}
+
+func (x *GetRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRequest.ProtoReflect.Descriptor instead.
+func (*GetRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_personpb_person_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{4}
+}
+
+type SearchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Communication string                 `protobuf:"bytes,2,opt,name=communication,proto3" json:"communication,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_personpb_person_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SearchRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetCommunication() string {
+	if x != nil {
+		return x.Communication
+	}
+	return ""
+}
+
+type SearchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Persons       []*Person              `protobuf:"bytes,1,rep,name=persons,proto3" json:"persons,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResponse) Reset() {
+	*x = SearchResponse{}
+	mi := &file_personpb_person_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResponse) ProtoMessage() {}
+
+func (x *SearchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResponse.ProtoReflect.Descriptor instead.
+func (*SearchResponse) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SearchResponse) GetPersons() []*Person {
+	if x != nil {
+		return x.Persons
+	}
+	return nil
+}
+
+type UpdateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Person        *Person                `protobuf:"bytes,1,opt,name=person,proto3" json:"person,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateRequest) Reset() {
+	*x = UpdateRequest{}
+	mi := &file_personpb_person_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateRequest) ProtoMessage() {}
+
+func (x *UpdateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateRequest.ProtoReflect.Descriptor instead.
+func (*UpdateRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *UpdateRequest) GetPerson() *Person {
+	if x != nil {
+		return x.Person
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_personpb_person_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_personpb_person_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_personpb_person_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DeleteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+var File_personpb_person_proto protoreflect.FileDescriptor
+
+const file_personpb_person_proto_rawDesc = "" +
+	"\n" +
+	"\x15personpb/person.proto\x12\tperson.v1\"%\n" +
+	"\rCommunication\x12\x14\n" +
+	"\x05value\x18\x01 \x01(\tR\x05value\"n\n" +
+	"\x06Person\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12@\n" +
+	"\x0ecommunications\x18\x03 \x03(\v2\x18.person.v1.CommunicationR\x0ecommunications\":\n" +
+	"\rCreateRequest\x12)\n" +
+	"\x06person\x18\x01 \x01(\v2\x11.person.v1.PersonR\x06person\"\x1c\n" +
+	"\n" +
+	"GetRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\r\n" +
+	"\vListRequest\"I\n" +
+	"\rSearchRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12$\n" +
+	"\rcommunication\x18\x02 \x01(\tR\rcommunication\"=\n" +
+	"\x0eSearchResponse\x12+\n" +
+	"\apersons\x18\x01 \x03(\v2\x11.person.v1.PersonR\apersons\":\n" +
+	"\rUpdateRequest\x12)\n" +
+	"\x06person\x18\x01 \x01(\v2\x11.person.v1.PersonR\x06person\"\x1f\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id2\xd9\x02\n" +
+	"\rPersonService\x125\n" +
+	"\x06Create\x12\x18.person.v1.CreateRequest\x1a\x11.person.v1.Person\x12/\n" +
+	"\x03Get\x12\x15.person.v1.GetRequest\x1a\x11.person.v1.Person\x123\n" +
+	"\x04List\x12\x16.person.v1.ListRequest\x1a\x11.person.v1.Person0\x01\x12=\n" +
+	"\x06Search\x12\x18.person.v1.SearchRequest\x1a\x19.person.v1.SearchResponse\x125\n" +
+	"\x06Update\x12\x18.person.v1.UpdateRequest\x1a\x11.person.v1.Person\x125\n" +
+	"\x06Delete\x12\x18.person.v1.DeleteRequest\x1a\x11.person.v1.PersonB\x18Z\x16PersonService/personpbb\x06proto3"
+
+var (
+	file_personpb_person_proto_rawDescOnce sync.Once
+	file_personpb_person_proto_rawDescData []byte
+)
+
+func file_personpb_person_proto_rawDescGZIP() []byte {
+	file_personpb_person_proto_rawDescOnce.Do(func() {
+		file_personpb_person_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_personpb_person_proto_rawDesc), len(file_personpb_person_proto_rawDesc)))
+	})
+	return file_personpb_person_proto_rawDescData
+}
+
+var file_personpb_person_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_personpb_person_proto_goTypes = []any{
+	(*Communication)(nil),  // 0: person.v1.Communication
+	(*Person)(nil),         // 1: person.v1.Person
+	(*CreateRequest)(nil),  // 2: person.v1.CreateRequest
+	(*GetRequest)(nil),     // 3: person.v1.GetRequest
+	(*ListRequest)(nil),    // 4: person.v1.ListRequest
+	(*SearchRequest)(nil),  // 5: person.v1.SearchRequest
+	(*SearchResponse)(nil), // 6: person.v1.SearchResponse
+	(*UpdateRequest)(nil),  // 7: person.v1.UpdateRequest
+	(*DeleteRequest)(nil),  // 8: person.v1.DeleteRequest
+}
+var file_personpb_person_proto_depIdxs = []int32{
+	0,  // 0: person.v1.Person.communications:type_name -> person.v1.Communication
+	1,  // 1: person.v1.CreateRequest.person:type_name -> person.v1.Person
+	1,  // 2: person.v1.SearchResponse.persons:type_name -> person.v1.Person
+	1,  // 3: person.v1.UpdateRequest.person:type_name -> person.v1.Person
+	2,  // 4: person.v1.PersonService.Create:input_type -> person.v1.CreateRequest
+	3,  // 5: person.v1.PersonService.Get:input_type -> person.v1.GetRequest
+	4,  // 6: person.v1.PersonService.List:input_type -> person.v1.ListRequest
+	5,  // 7: person.v1.PersonService.Search:input_type -> person.v1.SearchRequest
+	7,  // 8: person.v1.PersonService.Update:input_type -> person.v1.UpdateRequest
+	8,  // 9: person.v1.PersonService.Delete:input_type -> person.v1.DeleteRequest
+	1,  // 10: person.v1.PersonService.Create:output_type -> person.v1.Person
+	1,  // 11: person.v1.PersonService.Get:output_type -> person.v1.Person
+	1,  // 12: person.v1.PersonService.List:output_type -> person.v1.Person
+	6,  // 13: person.v1.PersonService.Search:output_type -> person.v1.SearchResponse
+	1,  // 14: person.v1.PersonService.Update:output_type -> person.v1.Person
+	1,  // 15: person.v1.PersonService.Delete:output_type -> person.v1.Person
+	10, // [10:16] is the sub-list for method output_type
+	4,  // [4:10] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_personpb_person_proto_init() }
+func file_personpb_person_proto_init() {
+	if File_personpb_person_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_personpb_person_proto_rawDesc), len(file_personpb_person_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_personpb_person_proto_goTypes,
+		DependencyIndexes: file_personpb_person_proto_depIdxs,
+		MessageInfos:      file_personpb_person_proto_msgTypes,
+	}.Build()
+	File_personpb_person_proto = out.File
+	file_personpb_person_proto_goTypes = nil
+	file_personpb_person_proto_depIdxs = nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/rs/zerolog/log"
+)
+
+// NotifyEvent sends the event to every replica listening on the person events channel.
+// Postgres limits a notification to 8000 bytes, so a person too big for that is left
+// out and the listeners load it instead. It satisfies EventListener.
+func (s *PostgresStorage) NotifyEvent(e *PersonEvent) {
+	payload, err := json.Marshal(e)
+	if err == nil && len(payload) >= pgNotifyMaxPayload {
+		withoutPerson := *e
+		withoutPerson.Person = nil
+		payload, err = json.Marshal(&withoutPerson)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("event_id", e.ID.String()).Msg("postgres: could not encode event")
+		return
+	}
+	if _, err := s.db.Exec(`SELECT pg_notify($1, $2)`, postgresEventsChannel, string(payload)); err != nil {
+		log.Error().Err(err).Str("event_id", e.ID.String()).Msg("postgres: could not notify event")
+	}
+}
+
+// ListenEvents LISTENs on the person events channel and passes every
+// notification to publish until ctx is cancelled. Lost connections are re-established.
+func (s *PostgresStorage) ListenEvents(ctx context.Context, publish EventListener) {
+	for {
+		err := s.listen(ctx, publish)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warn().Err(err).Msg("postgres: event listener stopped")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (s *PostgresStorage) listen(ctx context.Context, publish EventListener) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+postgresEventsChannel); err != nil {
+			return err
+		}
+
+		for {
+			n, err := pgConn.WaitForNotification(ctx)
+			if err != nil {
+				return err
+			}
+
+			e := &PersonEvent{}
+			if err := json.Unmarshal([]byte(n.Payload), e); err != nil {
+				log.Error().Err(err).Msg("postgres: could not decode event")
+				continue
+			}
+			if e.Person == nil {
+				s.loadEventPerson(e)
+			}
+			publish(e)
+		}
+	})
+}
+
+// loadEventPerson fills in a person that didn't fit into the notification. The person
+// is read as it is now, which may be after later writes; a deleted one keeps only its id.
+func (s *PostgresStorage) loadEventPerson(e *PersonEvent) {
+	e.Person = &Person{ID: e.PersonID}
+	if e.Type == PersonDeleted {
+		return
+	}
+	p, err := s.GetPersonByID(e.PersonID)
+	if err != nil {
+		log.Warn().Err(err).Str("event_id", e.ID.String()).Msg("postgres: could not load event person")
+		return
+	}
+	e.Person = p
+}
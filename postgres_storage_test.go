@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	uuid "github.com/satori/go.uuid"
+)
+
+// pgxValueConverter passes arguments through untouched, like the pgx driver that encodes slices as arrays itself.
+type pgxValueConverter struct{}
+
+func (pgxValueConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	return v, nil
+}
+
+func newMockPostgres(t *testing.T) (*PostgresStorage, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(pgxValueConverter{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &PostgresStorage{db: sqlx.NewDb(db, "pgx"), ctx: context.Background(), outbox: true}, mock
+}
+
+func TestPostgresCommunications(t *testing.T) {
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe"}
+	ann := &Person{ID: uuid.NewV4(), Name: "Ann"}
+
+	t.Run("get all reads every communication in one unfiltered query", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		mock.ExpectQuery(`SELECT \* FROM person`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(joe.ID.String(), "Joe").AddRow(ann.ID.String(), "Ann"))
+		mock.ExpectQuery(`^SELECT PersonId, Value FROM Communication$`).WithArgs().
+			WillReturnRows(sqlmock.NewRows([]string{"personid", "value"}).
+				AddRow(joe.ID.String(), "box@mail.ua").AddRow(ann.ID.String(), "ann@mail.ua").AddRow(joe.ID.String(), "+380973224562"))
+
+		pp, err := s.GetAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pp) != 2 || len(pp[0].Communications) != 2 || len(pp[1].Communications) != 1 {
+			t.Errorf("got %+v", pp)
+		}
+	})
+
+	t.Run("ids are bound as one array", func(t *testing.T) {
+		s, mock := newMockPostgres(t)
+		ids := []string{joe.ID.String(), ann.ID.String()}
+		mock.ExpectQuery(`SELECT \* FROM person WHERE Id = ANY\(\$1\)`).WithArgs(ids).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(joe.ID.String(), "Joe").AddRow(ann.ID.String(), "Ann"))
+		mock.ExpectQuery(`FROM Communication WHERE PersonId = ANY\(\$1\)`).WithArgs(ids).
+			WillReturnRows(sqlmock.NewRows([]string{"personid", "value"}).AddRow(ann.ID.String(), "ann@mail.ua"))
+
+		pp, err := s.GetPersonsByIDs([]uuid.UUID{joe.ID, ann.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pp) != 2 || len(pp[1].Communications) != 1 {
+			t.Errorf("got %+v", pp)
+		}
+	})
+}
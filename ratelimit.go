@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// RateLimit allows Rate requests per second on average with bursts of up to Burst requests.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+type RateLimitConfig struct {
+	// User applies per authenticated user, Anonymous per client IP.
+	User      RateLimit
+	Anonymous RateLimit
+}
+
+type RateLimitDecision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again, RetryAfter the time until the next token.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimiter keeps the buckets. The in-memory implementation limits a single
+// replica; an implementation backed by a shared store limits all of them.
+type RateLimiter interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitDecision, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: map[string]*tokenBucket{}, now: time.Now}
+}
+
+func (l *MemoryRateLimiter) Take(_ context.Context, key string, limit RateLimit) (RateLimitDecision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if len(l.buckets) >= rateLimitMaxBuckets {
+		l.evict(now)
+	}
+
+	burst := float64(limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+
+	d := RateLimitDecision{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / limit.Rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((burst - b.tokens) / limit.Rate)
+	b.full = now.Add(d.Reset)
+	return d, nil
+}
+
+// evict drops the buckets that have refilled completely; they are equivalent to new ones.
+func (l *MemoryRateLimiter) evict(now time.Time) {
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// rateLimiting limits authenticated users by identity and everybody else by IP.
+// The health and metrics endpoints are never limited.
+func (s *Server) rateLimiting(next http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case healthzPath, readyzPath, metricsPath:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, limit := rateLimitKey(r), s.rateLimits.Anonymous
+		if identity, ok := requestIdentity(r); ok {
+			key, limit = "user:"+identity, s.rateLimits.User
+		}
+		if !limit.enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		d, err := s.rateLimiter.Take(r.Context(), key, limit)
+		if err != nil {
+			// Don't turn an outage of the limiter store into an outage of the service.
+			zerolog.Ctx(r.Context()).Warn().Err(err).Msg("rate limiter unavailable")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(rateLimitLimitHeader, strconv.Itoa(d.Limit))
+		w.Header().Set(rateLimitRemainingHeader, strconv.Itoa(d.Remaining))
+		w.Header().Set(rateLimitResetHeader, ceilSeconds(d.Reset))
+		if !d.Allowed {
+			w.Header().Set("Content-Type", contentTypeJSON)
+			w.Header().Set("Retry-After", ceilSeconds(d.RetryAfter))
+			handleError(rateLimitExceededError, w, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func rateLimitKey(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewMemoryRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := RateLimit{Rate: 2, Burst: 3}
+
+	for i := 0; i < 3; i++ {
+		d, _ := limiter.Take(context.Background(), "joe", limit)
+		if !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+
+	d, _ := limiter.Take(context.Background(), "joe", limit)
+	if d.Allowed || d.RetryAfter != 500*time.Millisecond || d.Reset != 1500*time.Millisecond {
+		t.Errorf("over limit: %+v", d)
+	}
+	if d, _ := limiter.Take(context.Background(), "louis", limit); !d.Allowed {
+		t.Error("buckets are shared between keys")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := limiter.Take(context.Background(), "joe", limit); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("after refill: %+v", d)
+	}
+}
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Take(context.Context, string, RateLimit) (RateLimitDecision, error) {
+	return RateLimitDecision{}, errors.New("connection refused")
+}
+
+func TestRateLimiting(t *testing.T) {
+	limits := RateLimitConfig{User: RateLimit{Rate: 1, Burst: 2}, Anonymous: RateLimit{Rate: 1, Burst: 1}}
+
+	request := func(server http.Handler, auth bool, path, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		if auth {
+			setRequestAuth(req)
+		}
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	t.Run("per user", func(t *testing.T) {
+		server := NewServer(NewInMemoryPersonStorage(), logBody,
+			WithRateLimiter(NewMemoryRateLimiter(), limits), WithHealth(NewHealth(healthCheckTimeout)))
+
+		response := request(server, true, "/person", "10.0.0.1:1234")
+		if response.Header().Get(rateLimitLimitHeader) != "2" || response.Header().Get(rateLimitRemainingHeader) != "1" {
+			t.Errorf("unexpected headers %v", response.Header())
+		}
+		request(server, true, "/person", "10.0.0.2:1234")
+
+		response = request(server, true, "/person", "10.0.0.3:1234")
+		assertStatus(t, response.Code, http.StatusTooManyRequests)
+		if response.Header().Get("Retry-After") != "1" {
+			t.Errorf("Retry-After = %q", response.Header().Get("Retry-After"))
+		}
+		req, _ := http.NewRequest("GET", "/person", nil)
+		if err := loadOpenAPI(t).validateResponse(req, response); err != nil {
+			t.Error(err)
+		}
+
+		assertStatus(t, request(server, true, healthzPath, "10.0.0.1:1234").Code, http.StatusOK)
+	})
+
+	t.Run("per ip for anonymous requests", func(t *testing.T) {
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithRateLimiter(NewMemoryRateLimiter(), limits))
+
+		assertStatus(t, request(server, false, "/person", "10.0.0.1:1234").Code, http.StatusUnauthorized)
+		assertStatus(t, request(server, false, "/person", "10.0.0.1:5678").Code, http.StatusTooManyRequests)
+		assertStatus(t, request(server, false, "/person", "10.0.0.2:1234").Code, http.StatusUnauthorized)
+		assertStatus(t, request(server, true, "/person", "10.0.0.1:1234").Code, http.StatusNotFound)
+	})
+
+	t.Run("limiter failure lets requests through", func(t *testing.T) {
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithRateLimiter(failingRateLimiter{}, limits))
+		assertStatus(t, request(server, true, "/person", "10.0.0.1:1234").Code, http.StatusNotFound)
+	})
+}
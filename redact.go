@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type RedactionMode string
+
+const (
+	RedactMask RedactionMode = "mask"
+	RedactHash RedactionMode = "hash"
+	RedactNone RedactionMode = "none"
+)
+
+// RedactionConfig describes how logged bodies are scrubbed. Fields are JSON paths
+// such as "name" or "communications[].value"; "[]" walks into every element of an array.
+type RedactionConfig struct {
+	Mode    RedactionMode
+	Fields  []string
+	Key     []byte
+	MaxBody int
+}
+
+// DefaultRedactionConfig masks person data and webhook secrets. A GraphQL query is
+// masked whole since literal arguments put personal data straight into its text.
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		Mode:    RedactMask,
+		Fields:  strings.Split(defaultRedactFields, ","),
+		MaxBody: defaultLogBodyMax,
+	}
+}
+
+// Redactor masks or hashes personal data in JSON bodies before they are logged.
+// Paths are matched against every object in the body, so persons nested in lists,
+// events or GraphQL responses are covered too.
+type Redactor struct {
+	mode    RedactionMode
+	paths   [][]string
+	key     []byte
+	maxBody int
+}
+
+func NewRedactor(cfg RedactionConfig) (*Redactor, error) {
+	switch cfg.Mode {
+	case RedactMask, RedactNone:
+	case RedactHash:
+		if len(cfg.Key) == 0 {
+			return nil, errors.New("hash redaction needs a key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q", cfg.Mode)
+	}
+
+	r := &Redactor{mode: cfg.Mode, key: cfg.Key, maxBody: cfg.MaxBody}
+	for _, field := range cfg.Fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		r.paths = append(r.paths, strings.Split(field, "."))
+	}
+	return r, nil
+}
+
+// Redact returns the body as it should appear in the log: redacted and cut to the size cap.
+// Bodies that can't be parsed are not logged at all since they can't be redacted.
+func (r *Redactor) Redact(body []byte) string {
+	if r.mode != RedactNone && len(r.paths) != 0 {
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		var v interface{}
+		if err := d.Decode(&v); err != nil {
+			return fmt.Sprintf(redactedBodyMarker, len(body))
+		}
+		r.walk(v)
+		body, _ = json.Marshal(v)
+	}
+	return r.truncate(body)
+}
+
+func (r *Redactor) truncate(body []byte) string {
+	if r.maxBody <= 0 || len(body) <= r.maxBody {
+		return string(body)
+	}
+	return string(body[:r.maxBody]) + fmt.Sprintf(truncatedBodyMarker, len(body)-r.maxBody)
+}
+
+func (r *Redactor) walk(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, path := range r.paths {
+			r.apply(v, path)
+		}
+		for _, child := range v {
+			r.walk(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			r.walk(child)
+		}
+	}
+}
+
+func (r *Redactor) apply(v interface{}, path []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return
+	}
+	name := strings.TrimSuffix(path[0], "[]")
+	value, ok := m[name]
+	if !ok || value == nil {
+		return
+	}
+	last := len(path) == 1
+
+	if name == path[0] {
+		if last {
+			m[name] = r.replace(value)
+		} else {
+			r.apply(value, path[1:])
+		}
+		return
+	}
+
+	items, ok := value.([]interface{})
+	if !ok {
+		return
+	}
+	for i, item := range items {
+		if last {
+			items[i] = r.replace(item)
+		} else {
+			r.apply(item, path[1:])
+		}
+	}
+}
+
+func (r *Redactor) replace(value interface{}) interface{} {
+	if r.mode == RedactMask {
+		return redactMask
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		b, _ := json.Marshal(value)
+		s = string(b)
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(s))
+	return "hmac:" + hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ResilienceConfig struct {
+	// Timeout bounds every attempt on backends that take a context.
+	Timeout     time.Duration
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// The circuit opens after FailureThreshold attempts in a row failed transiently
+	// and lets a single probe through once OpenTimeout has passed.
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func DefaultResilienceConfig() ResilienceConfig {
+	return ResilienceConfig{
+		Timeout:          storageTimeout,
+		MaxAttempts:      storageMaxAttempts,
+		BaseBackoff:      storageBaseBackoff,
+		MaxBackoff:       storageMaxBackoff,
+		FailureThreshold: breakerFailureThreshold,
+		OpenTimeout:      breakerOpenTimeout,
+	}
+}
+
+// CircuitOpenError is returned without calling the backend while the circuit is open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string { return storageUnavailableError.Error() }
+
+func (e *CircuitOpenError) Unwrap() error { return storageUnavailableError }
+
+// ResilientStorage retries transient backend errors with jittered backoff, bounds
+// each attempt with a timeout and stops calling a backend that keeps failing.
+// Reads, updates and deletes are retried since repeating them is harmless; an
+// add is only retried when the person has an id, which makes a repeat detectable.
+type ResilientStorage struct {
+	Storage
+	ctx     context.Context
+	cfg     ResilienceConfig
+	breaker *circuitBreaker
+	sleep   func(context.Context, time.Duration) error
+}
+
+func NewResilientStorage(storage Storage, cfg ResilienceConfig) *ResilientStorage {
+	return &ResilientStorage{
+		Storage: storage,
+		ctx:     context.Background(),
+		cfg:     cfg,
+		breaker: &circuitBreaker{threshold: cfg.FailureThreshold, openTimeout: cfg.OpenTimeout, now: time.Now},
+		sleep:   sleepContext,
+	}
+}
+
+// WithContext bounds the attempts by ctx as well as by the attempt timeout.
+func (s *ResilientStorage) WithContext(ctx context.Context) Storage {
+	res := *s
+	res.ctx = ctx
+	res.Storage = storageWithContext(s.Storage, ctx)
+	return &res
+}
+
+func resilientCall[T any](s *ResilientStorage, retry bool, fn func(Storage) (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		wait, ok, probe := s.breaker.allow()
+		if !ok {
+			var zero T
+			return zero, &CircuitOpenError{RetryAfter: wait}
+		}
+
+		storage, cancel := s.Storage, func() {}
+		if s.cfg.Timeout > 0 {
+			var ctx context.Context
+			ctx, cancel = context.WithTimeout(s.ctx, s.cfg.Timeout)
+			storage = storageWithContext(storage, ctx)
+		}
+		res, err := fn(storage)
+		cancel()
+
+		// The caller gave up, which says nothing about the backend and leaves no one to retry for.
+		if s.ctx.Err() != nil {
+			if probe {
+				s.breaker.abandon()
+			}
+			return res, err
+		}
+		transient := isTransient(err)
+		s.breaker.record(!transient)
+		if !transient || !retry || attempt >= s.cfg.MaxAttempts {
+			return res, err
+		}
+		if s.sleep(s.ctx, s.backoff(attempt)) != nil {
+			return res, err
+		}
+	}
+}
+
+// sleepContext waits for d, or less when ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// backoff is "full jitter": a random wait up to the exponential backoff, so retries of many clients spread out.
+func (s *ResilientStorage) backoff(attempt int) time.Duration {
+	backoff := s.cfg.BaseBackoff << uint(attempt-1)
+	if backoff <= 0 || backoff > s.cfg.MaxBackoff {
+		backoff = s.cfg.MaxBackoff
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return rand.N(backoff) + 1
+}
+
+func (s *ResilientStorage) GetAll() ([]*Person, error) {
+	return resilientCall(s, true, func(st Storage) ([]*Person, error) { return st.GetAll() })
+}
+
+func (s *ResilientStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	return resilientCall(s, true, func(st Storage) (*Person, error) { return st.GetPersonByID(id) })
+}
+
+func (s *ResilientStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	return resilientCall(s, true, func(st Storage) ([]*Person, error) { return st.GetPersonsByIDs(ids) })
+}
+
+func (s *ResilientStorage) GetPersonsByName(name string) ([]*Person, error) {
+	return resilientCall(s, true, func(st Storage) ([]*Person, error) { return st.GetPersonsByName(name) })
+}
+
+func (s *ResilientStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	return resilientCall(s, true, func(st Storage) ([]*Person, error) { return st.GetPersonsByCommunication(value) })
+}
+
+func (s *ResilientStorage) Add(p *Person) (*Person, error) {
+	attempted := false
+	return resilientCall(s, !uuid.Equal(p.ID, uuid.Nil), func(st Storage) (*Person, error) {
+		res, err := st.Add(p)
+		if err == personExistError && attempted {
+			// The failed attempt may have gone through before its connection broke,
+			// or someone else added a person with the same id in the meantime.
+			stored, getErr := st.GetPersonByID(p.ID)
+			if getErr != nil || !samePerson(stored, p) {
+				return nil, personExistError
+			}
+			return stored, nil
+		}
+		attempted = true
+		return res, err
+	})
+}
+
+// samePerson tells whether a and b have the same name and communications. The order
+// of the communications doesn't matter, since not every backend keeps it.
+func samePerson(a, b *Person) bool {
+	if a.Name != b.Name || len(a.Communications) != len(b.Communications) {
+		return false
+	}
+	values := make(map[string]int, len(a.Communications))
+	for _, c := range a.Communications {
+		values[c.Value]++
+	}
+	for _, c := range b.Communications {
+		if values[c.Value] == 0 {
+			return false
+		}
+		values[c.Value]--
+	}
+	return true
+}
+
+func (s *ResilientStorage) UpdatePerson(p *Person) (*Person, error) {
+	return resilientCall(s, true, func(st Storage) (*Person, error) { return st.UpdatePerson(p) })
+}
+
+func (s *ResilientStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	return resilientCall(s, true, func(st Storage) (*Person, error) { return st.DeletePerson(id) })
+}
+
+// isTransient tells errors that may go away on their own, like a dropped connection,
+// a timeout or a serialization failure, from the ones that will happen again.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, personNotFoundError) || errors.Is(err, personExistError) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "40001", pgErr.Code == "40P01": // serialization failure, deadlock
+			return true
+		case strings.HasPrefix(pgErr.Code, "08"), strings.HasPrefix(pgErr.Code, "57P"), pgErr.Code == "53300": // connection, shutdown, too many connections
+			return true
+		}
+		return false
+	}
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return true
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+
+	if mongo.IsNetworkError(err) || mongo.IsTimeout(err) {
+		return true
+	}
+	var labeled interface{ HasErrorLabel(string) bool }
+	if errors.As(err, &labeled) {
+		return labeled.HasErrorLabel("TransientTransactionError") || labeled.HasErrorLabel("RetryableWriteError")
+	}
+	return false
+}
+
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	probing  bool
+}
+
+// allow tells whether a call may go to the backend, and if not, how long until the next probe.
+// probe is set for the one call let through an open circuit to see whether the backend is back.
+func (b *circuitBreaker) allow() (wait time.Duration, ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return 0, true, false
+	}
+	wait = b.openedAt.Add(b.openTimeout).Sub(b.now())
+	if wait > 0 {
+		return wait, false, false
+	}
+	if b.probing {
+		// Another call is finding out whether the backend is back.
+		return time.Second, false, false
+	}
+	b.probing = true
+	return 0, true, true
+}
+
+// abandon ends a probe whose caller went away before it told anything. The circuit
+// stays open for another openTimeout, as after a failed probe, without counting a failure.
+func (b *circuitBreaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.openedAt, b.probing = b.now(), false
+}
+
+func (b *circuitBreaker) record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.failures, b.open, b.probing = 0, false, false
+		return
+	}
+	b.failures++
+	if b.probing || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.open, b.openedAt, b.probing = true, b.now(), false
+	}
+}
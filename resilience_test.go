@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+)
+
+// flakyStorage fails the next calls with the queued errors, then passes them through.
+type flakyStorage struct {
+	Storage
+	errs  []error
+	calls int
+}
+
+func (s *flakyStorage) fail() error {
+	s.calls++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *flakyStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	if err := s.fail(); err != nil {
+		return nil, err
+	}
+	return s.Storage.GetPersonByID(id)
+}
+
+func (s *flakyStorage) Add(p *Person) (*Person, error) {
+	if err := s.fail(); err != nil {
+		// The write went through, but the answer got lost.
+		s.Storage.Add(p)
+		return nil, err
+	}
+	return s.Storage.Add(p)
+}
+
+// slowStorage answers only when its context is done.
+type slowStorage struct {
+	Storage
+	ctx context.Context
+}
+
+func (s *slowStorage) WithContext(ctx context.Context) Storage {
+	return &slowStorage{s.Storage, ctx}
+}
+
+func (s *slowStorage) GetPersonByID(uuid.UUID) (*Person, error) {
+	<-s.ctx.Done()
+	return nil, s.ctx.Err()
+}
+
+func TestResilientStorage(t *testing.T) {
+	joe := &Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"), Name: "Joe"}
+	reset := fmt.Errorf("read: %w", syscall.ECONNRESET)
+	cfg := ResilienceConfig{MaxAttempts: 3, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond, FailureThreshold: 5, OpenTimeout: time.Minute}
+
+	setup := func(errs ...error) (*ResilientStorage, *flakyStorage) {
+		backend := &flakyStorage{Storage: NewInMemoryPersonStorage(), errs: errs}
+		backend.Storage.Add(joe)
+		s := NewResilientStorage(backend, cfg)
+		s.sleep = func(context.Context, time.Duration) error { return nil }
+		return s, backend
+	}
+
+	t.Run("retries transient errors", func(t *testing.T) {
+		s, backend := setup(reset, reset)
+		p, err := s.GetPersonByID(joe.ID)
+
+		if err != nil || p.Name != "Joe" || backend.calls != 3 {
+			t.Errorf("got %v, %v after %d calls", p, err, backend.calls)
+		}
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		s, backend := setup(reset, reset, reset, reset)
+		_, err := s.GetPersonByID(joe.ID)
+
+		if !errors.Is(err, syscall.ECONNRESET) || backend.calls != 3 {
+			t.Errorf("got %v after %d calls", err, backend.calls)
+		}
+	})
+
+	t.Run("doesn't retry permanent errors", func(t *testing.T) {
+		s, backend := setup(&pgconn.PgError{Code: "42P01"})
+		s.GetPersonByID(joe.ID)
+		s.GetPersonByID(uuid.NewV4())
+
+		if backend.calls != 2 {
+			t.Errorf("backend calls = %d, want 2", backend.calls)
+		}
+	})
+
+	t.Run("keyed add is retried", func(t *testing.T) {
+		s, backend := setup(reset)
+		louis := &Person{ID: uuid.NewV4(), Name: "Louis"}
+		p, err := s.Add(louis)
+
+		// The retry finds the person added by the failed attempt and reads it back.
+		if err != nil || p.ID != louis.ID || backend.calls != 3 {
+			t.Errorf("got %v, %v after %d calls", p, err, backend.calls)
+		}
+	})
+
+	t.Run("keyed add retry doesn't claim someone else's person", func(t *testing.T) {
+		s, _ := setup(reset)
+
+		// The retry finds a person with the id, but not the one that was added.
+		p, err := s.Add(&Person{ID: joe.ID, Name: "Joe Junior"})
+		if err != personExistError {
+			t.Errorf("got %v, %v, want %v", p, err, personExistError)
+		}
+	})
+
+	t.Run("add without id is not retried", func(t *testing.T) {
+		s, backend := setup(reset)
+		_, err := s.Add(&Person{Name: "Louis"})
+
+		if err == nil || backend.calls != 1 {
+			t.Errorf("got %v after %d calls", err, backend.calls)
+		}
+	})
+
+	t.Run("circuit breaker", func(t *testing.T) {
+		s, backend := setup(reset, reset, reset, reset, reset)
+		now := time.Now()
+		s.breaker.now = func() time.Time { return now }
+
+		s.GetPersonByID(joe.ID)
+		s.GetPersonByID(joe.ID)
+		_, err := s.GetPersonByID(joe.ID)
+		var open *CircuitOpenError
+		if !errors.As(err, &open) || open.RetryAfter != time.Minute || backend.calls != 5 {
+			t.Fatalf("got %v after %d calls", err, backend.calls)
+		}
+
+		now = now.Add(time.Minute)
+		if p, err := s.GetPersonByID(joe.ID); err != nil || p.Name != "Joe" {
+			t.Fatalf("probe got %v, %v", p, err)
+		}
+		if _, err := s.GetPersonByID(joe.ID); err != nil {
+			t.Errorf("circuit still open after a successful probe: %v", err)
+		}
+	})
+
+	t.Run("a failed probe opens the circuit again", func(t *testing.T) {
+		s, _ := setup(reset, reset, reset, reset, reset, reset)
+		now := time.Now()
+		s.breaker.now = func() time.Time { return now }
+		s.GetPersonByID(joe.ID)
+		s.GetPersonByID(joe.ID)
+
+		now = now.Add(time.Minute)
+		_, err := s.GetPersonByID(joe.ID)
+		if !errors.Is(err, storageUnavailableError) {
+			t.Errorf("err = %v, want the circuit open again", err)
+		}
+	})
+
+	t.Run("a cancelled probe doesn't keep the circuit open", func(t *testing.T) {
+		s, _ := setup(reset, reset, reset, reset, reset)
+		now := time.Now()
+		s.breaker.now = func() time.Time { return now }
+		s.GetPersonByID(joe.ID)
+		s.GetPersonByID(joe.ID)
+
+		now = now.Add(time.Minute)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		storageWithContext(s, ctx).GetPersonByID(joe.ID)
+
+		_, err := s.GetPersonByID(joe.ID)
+		var open *CircuitOpenError
+		if !errors.As(err, &open) || open.RetryAfter != time.Minute {
+			t.Fatalf("err = %v, want the circuit open for another minute", err)
+		}
+		now = now.Add(time.Minute)
+		if p, err := s.GetPersonByID(joe.ID); err != nil || p.Name != "Joe" {
+			t.Errorf("next probe got %v, %v", p, err)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cfg := cfg
+		cfg.Timeout = 10 * time.Millisecond
+		s := NewResilientStorage(&slowStorage{Storage: NewInMemoryPersonStorage(), ctx: context.Background()}, cfg)
+		s.sleep = func(context.Context, time.Duration) error { return nil }
+
+		start := time.Now()
+		_, err := s.GetPersonByID(joe.ID)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v", elapsed)
+		}
+	})
+
+	t.Run("attempts end with the caller's context", func(t *testing.T) {
+		cfg := cfg
+		cfg.Timeout = time.Minute
+		backend := &slowStorage{Storage: NewInMemoryPersonStorage(), ctx: context.Background()}
+		s := NewResilientStorage(backend, cfg)
+		sleeps := 0
+		s.sleep = func(context.Context, time.Duration) error { sleeps++; return nil }
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := storageWithContext(s, ctx).GetPersonByID(joe.ID)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v", elapsed)
+		}
+		if sleeps != 0 {
+			t.Errorf("retried %d times for a caller that is gone", sleeps)
+		}
+	})
+
+	t.Run("backoff ends with the caller's context", func(t *testing.T) {
+		cfg := cfg
+		cfg.BaseBackoff, cfg.MaxBackoff = time.Minute, time.Minute
+		backend := &flakyStorage{Storage: NewInMemoryPersonStorage(), errs: []error{reset, reset}}
+		s := NewResilientStorage(backend, cfg)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		_, err := storageWithContext(s, ctx).GetPersonByID(joe.ID)
+		if !errors.Is(err, syscall.ECONNRESET) || backend.calls != 1 {
+			t.Errorf("got %v after %d calls", err, backend.calls)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("took %v", elapsed)
+		}
+	})
+}
+
+func TestSamePerson(t *testing.T) {
+	comms := func(values ...string) []*Communication {
+		cc := []*Communication{}
+		for _, v := range values {
+			cc = append(cc, &Communication{Value: v})
+		}
+		return cc
+	}
+	joe := &Person{Name: "Joe", Communications: comms("box@mail.ua", "+380973224562", "box@mail.ua")}
+
+	tests := []struct {
+		other *Person
+		want  bool
+	}{
+		{&Person{Name: "Joe", Communications: comms("box@mail.ua", "+380973224562", "box@mail.ua")}, true},
+		{&Person{Name: "Joe", Communications: comms("+380973224562", "box@mail.ua", "box@mail.ua")}, true},
+		{&Person{Name: "Joe", Communications: comms("+380973224562", "+380973224562", "box@mail.ua")}, false},
+		{&Person{Name: "Joe", Communications: comms("box@mail.ua", "+380973224562")}, false},
+		{&Person{Name: "Louis", Communications: comms("box@mail.ua", "+380973224562", "box@mail.ua")}, false},
+	}
+	for i, tt := range tests {
+		if got := samePerson(joe, tt.other); got != tt.want {
+			t.Errorf("case %d: samePerson = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{personNotFoundError, false},
+		{personExistError, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("write: %w", syscall.EPIPE), true},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true},
+		{&pgconn.PgError{Code: "40001"}, true},
+		{&pgconn.PgError{Code: "08006"}, true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{errors.New("syntax error"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransient(tt.err); got != tt.want {
+			t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCircuitOpenResponse(t *testing.T) {
+	storage := NewResilientStorage(&flakyStorage{Storage: NewInMemoryPersonStorage()}, DefaultResilienceConfig())
+	storage.breaker.open, storage.breaker.openedAt = true, time.Now()
+	server := NewServer(storage, logBody)
+
+	req, _ := http.NewRequest("GET", "/person/02a883a3-13c4-4624-bbba-edc744f69534", nil)
+	setRequestAuth(req)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, req)
+
+	assertStatus(t, response.Code, http.StatusServiceUnavailable)
+	if got := response.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+}
@@ -72,10 +72,15 @@ func TestAddPerson(t *testing.T) {
 		server.ServeHTTP(response, req)
 
 		assertStatus(t, response.Code, http.StatusCreated)
-		var want, got *Person
-		err1 := json.Unmarshal([]byte(reqBody), want)
-		err2 := json.Unmarshal(response.Body.Bytes(), got)
-		if err1 == nil && err2 == nil && !reflect.DeepEqual(want, got) {
+		// The body is the stored person, it used to be null.
+		want, got := &Person{}, &Person{}
+		if err := json.Unmarshal([]byte(reqBody), want); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, got) {
 			personsNotEqualError(t, want, got)
 		}
 	})
@@ -122,7 +127,7 @@ func TestGetPersons(t *testing.T) {
 		p1Id: p1,
 		p2Id: p2,
 	}
-	s := &InMemoryPersonStorage{data}
+	s := &InMemoryPersonStorage{data: data}
 	server := NewServer(s, logBody)
 
 	t.Run("get persons without param", func(t *testing.T) {
@@ -319,7 +324,7 @@ func TestDelete(t *testing.T) {
 		Communications: []*Communication{{Value: "box@mail.ua"}, {Value: "+380974583947"}},
 	}
 	data := map[uuid.UUID]*Person{pId: p}
-	server := NewServer(&InMemoryPersonStorage{data}, logBody)
+	server := NewServer(&InMemoryPersonStorage{data: data}, logBody)
 
 	t.Run("wrong id", func(t *testing.T) {
 		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/person/123%v", pId.String()), nil)
@@ -441,3 +446,43 @@ func assertPersonsArrays(t *testing.T, want, got []*Person) {
 func setRequestAuth(r *http.Request) {
 	r.SetBasicAuth(authLogin, authPassword)
 }
+
+// The HTTP handlers apply the same Person.Validate rules as the gRPC service, so a
+// person that one API rejects can't be stored through the other.
+func TestPersonValidation(t *testing.T) {
+	storage := NewInMemoryPersonStorage()
+	server := NewServer(storage, logBody)
+	send := func(method, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/person", strings.NewReader(body))
+		req.Header.Add("Content-Type", contentTypeJSON)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+		server.ServeHTTP(response, req)
+		return response
+	}
+
+	for _, method := range []string{"POST", "PUT"} {
+		for name, body := range map[string]string{
+			"nil id":     `{"id": "00000000-0000-0000-0000-000000000000", "name": "Joe"}`,
+			"missing id": `{"name": "Joe"}`,
+			"blank name": `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "  "}`,
+		} {
+			t.Run(method+" "+name, func(t *testing.T) {
+				response := send(method, body)
+
+				assertStatus(t, response.Code, http.StatusBadRequest)
+				if !strings.Contains(response.Body.String(), notValidPersonError.Error()) {
+					t.Errorf("got body %s", response.Body)
+				}
+				if pp, _ := storage.GetAll(); len(pp) != 0 {
+					t.Errorf("invalid person was stored: %+v", pp)
+				}
+			})
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		assertStatus(t, send("POST", `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Joe"}`).Code, http.StatusCreated)
+		assertStatus(t, send("PUT", `{"id": "02a883a3-13c4-4624-bbba-edc744f69534", "name": "Louis"}`).Code, http.StatusOK)
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	uuid "github.com/satori/go.uuid"
+)
+
+const sqliteSchema = `
+	CREATE TABLE IF NOT EXISTS person (
+		id   TEXT PRIMARY KEY,
+		name TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS communication (
+		value    TEXT NOT NULL,
+		personid TEXT NOT NULL REFERENCES person (id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS person_name ON person (name);
+	CREATE INDEX IF NOT EXISTS communication_personid ON communication (personid);
+	CREATE INDEX IF NOT EXISTS communication_value ON communication (value);`
+
+// SQLiteStorage keeps persons in an embedded SQLite database file, for a single
+// node or tests that need durable storage without a database server. The
+// database runs in WAL mode, so reads don't wait for a write to finish.
+type SQLiteStorage struct {
+	db  *sqlx.DB
+	ctx context.Context
+}
+
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	// Transactions take the write lock up front, so two writers never deadlock upgrading a read lock.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_foreign_keys=on&_synchronous=NORMAL&_busy_timeout=%d&_txlock=immediate",
+		path, sqliteBusyTimeout.Milliseconds())
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStorage{db: db, ctx: context.Background()}, nil
+}
+
+// WithContext returns the storage running its queries under ctx, so they stop at its deadline.
+func (s *SQLiteStorage) WithContext(ctx context.Context) Storage {
+	c := *s
+	c.ctx = ctx
+	return &c
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStorage) Count(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.GetContext(ctx, &n, `SELECT count(*) FROM person`)
+	return n, err
+}
+
+func (s *SQLiteStorage) GetAll() ([]*Person, error) {
+	var pp []*Person
+
+	err := s.db.SelectContext(s.ctx, &pp, `SELECT id, name FROM person`)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+
+	// Every communication belongs to one of them, so there is nothing to filter by.
+	return pp, s.attachCommunications(pp, `SELECT personid, value FROM communication ORDER BY rowid`)
+}
+
+func (s *SQLiteStorage) Add(p *Person) (*Person, error) {
+	err := s.inTx(func(tx *sqlx.Tx) error {
+		return s.insertPerson(tx, p)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetPersonByID(p.ID)
+}
+
+func (s *SQLiteStorage) insertPerson(tx *sqlx.Tx, p *Person) error {
+	_, err := tx.ExecContext(s.ctx, `INSERT INTO person (id, name) VALUES (?, ?)`, p.ID.String(), p.Name)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return personExistError
+		}
+		return err
+	}
+
+	for _, com := range p.Communications {
+		_, err = tx.ExecContext(s.ctx, `INSERT INTO communication (value, personid) VALUES (?, ?)`, com.Value, p.ID.String())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	p := &Person{}
+	err := s.db.GetContext(s.ctx, p, `SELECT id, name FROM person WHERE id = ?`, id.String())
+	if err == sql.ErrNoRows {
+		return nil, personNotFoundError
+	} else if err != nil {
+		return nil, err
+	}
+
+	return p, s.loadCommunications([]*Person{p})
+}
+
+func (s *SQLiteStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	if len(ids) == 0 {
+		return []*Person{}, nil
+	}
+
+	pIds := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pIds = append(pIds, id.String())
+	}
+
+	pp := []*Person{}
+	for _, batch := range sqliteBatches(pIds) {
+		query, args, err := sqlx.In(`SELECT id, name FROM person WHERE id IN (?)`, batch)
+		if err != nil {
+			return nil, err
+		}
+		var found []*Person
+		if err := s.db.SelectContext(s.ctx, &found, query, args...); err != nil {
+			return nil, err
+		}
+		pp = append(pp, found...)
+	}
+
+	return pp, s.loadCommunications(pp)
+}
+
+func (s *SQLiteStorage) GetPersonsByName(name string) ([]*Person, error) {
+	pp := []*Person{}
+	err := s.db.SelectContext(s.ctx, &pp, `SELECT id, name FROM person WHERE name = ?`, name)
+	if err != nil {
+		return nil, err
+	} else if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+
+	return pp, s.loadCommunications(pp)
+}
+
+func (s *SQLiteStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	pp := []*Person{}
+	err := s.db.SelectContext(s.ctx, &pp, `SELECT id, name FROM person
+		WHERE id IN (SELECT personid FROM communication WHERE value = ?)`, value)
+	if err != nil {
+		return nil, err
+	} else if len(pp) == 0 {
+		return nil, personNotFoundError
+	}
+
+	return pp, s.loadCommunications(pp)
+}
+
+// loadCommunications fills the communications of all given persons, in the order they were added.
+// It takes one query per sqliteMaxVariables persons, the most ids a statement can bind.
+func (s *SQLiteStorage) loadCommunications(pp []*Person) error {
+	pIds := make([]string, 0, len(pp))
+	for _, p := range pp {
+		pIds = append(pIds, p.ID.String())
+	}
+
+	for _, batch := range sqliteBatches(pIds) {
+		query, args, err := sqlx.In(`SELECT personid, value FROM communication WHERE personid IN (?) ORDER BY rowid`, batch)
+		if err != nil {
+			return err
+		}
+		if err := s.attachCommunications(pp, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachCommunications runs query, which selects personid and value, and adds the rows to the matching persons.
+func (s *SQLiteStorage) attachCommunications(pp []*Person, query string, args ...interface{}) error {
+	byID := make(map[string]*Person, len(pp))
+	for _, p := range pp {
+		byID[p.ID.String()] = p
+	}
+
+	var rows []*communicationRow
+	if err := s.db.SelectContext(s.ctx, &rows, query, args...); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if p, ok := byID[row.PersonID]; ok {
+			p.Communications = append(p.Communications, &Communication{Value: row.Value})
+		}
+	}
+	return nil
+}
+
+// sqliteBatches splits ids into slices that fit into the variables of one statement.
+func sqliteBatches(ids []string) [][]string {
+	var batches [][]string
+	for len(ids) > sqliteMaxVariables {
+		batches = append(batches, ids[:sqliteMaxVariables])
+		ids = ids[sqliteMaxVariables:]
+	}
+	if len(ids) != 0 {
+		batches = append(batches, ids)
+	}
+	return batches
+}
+
+func (s *SQLiteStorage) UpdatePerson(p *Person) (*Person, error) {
+	err := s.inTx(func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(s.ctx, `UPDATE person SET name = ? WHERE id = ?`, p.Name, p.ID.String())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return personNotFoundError
+		}
+		if _, err := tx.ExecContext(s.ctx, `DELETE FROM communication WHERE personid = ?`, p.ID.String()); err != nil {
+			return err
+		}
+		for _, com := range p.Communications {
+			_, err = tx.ExecContext(s.ctx, `INSERT INTO communication (value, personid) VALUES (?, ?)`, com.Value, p.ID.String())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPersonByID(p.ID)
+}
+
+func (s *SQLiteStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	p, err := s.GetPersonByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.inTx(func(tx *sqlx.Tx) error {
+		// The communications go with the person, see ON DELETE CASCADE.
+		res, err := tx.ExecContext(s.ctx, `DELETE FROM person WHERE id = ?`, id.String())
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return personNotFoundError
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (s *SQLiteStorage) inTx(fn func(*sqlx.Tx) error) error {
+	tx, err := s.db.BeginTxx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestStorageBackends runs the same behavior against every backend that works without a server.
+func TestStorageBackends(t *testing.T) {
+	backends := map[string]func(t *testing.T) Storage{
+		"memory": func(t *testing.T) Storage {
+			return NewInMemoryPersonStorage()
+		},
+		"memory with persistence": func(t *testing.T) Storage {
+			s, err := OpenInMemoryPersonStorage(PersistenceConfig{Dir: t.TempDir(), Sync: walSyncNever})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+		"sqlite": func(t *testing.T) Storage {
+			s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "persons.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+		"bolt": func(t *testing.T) Storage {
+			s, err := NewBoltStorage(filepath.Join(t.TempDir(), "persons.bolt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			testStorage(t, newStorage(t))
+		})
+	}
+}
+
+func testStorage(t *testing.T, s Storage) {
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe", Communications: []*Communication{{"box@mail.ua"}, {"+380973224562"}}}
+	ann := &Person{ID: uuid.NewV4(), Name: "Ann", Communications: []*Communication{{"box@mail.ua"}}}
+	other := &Person{ID: uuid.NewV4(), Name: "Joe"}
+
+	for _, p := range []*Person{joe, ann, other} {
+		got, err := s.Add(p)
+		if err != nil {
+			t.Fatalf("Add(%v): %v", p.Name, err)
+		}
+		assertSamePerson(t, got, p)
+	}
+
+	t.Run("add existing", func(t *testing.T) {
+		if _, err := s.Add(&Person{ID: joe.ID, Name: "Someone"}); err != personExistError {
+			t.Errorf("err = %v, want %v", err, personExistError)
+		}
+		p, _ := s.GetPersonByID(joe.ID)
+		assertSamePerson(t, p, joe)
+	})
+
+	t.Run("get by id", func(t *testing.T) {
+		p, err := s.GetPersonByID(joe.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSamePerson(t, p, joe)
+
+		if _, err := s.GetPersonByID(uuid.NewV4()); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+	})
+
+	t.Run("get all", func(t *testing.T) {
+		pp, err := s.GetAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe, ann, other)
+	})
+
+	t.Run("count", func(t *testing.T) {
+		n, err := s.(PersonCounter).Count(context.Background())
+		if err != nil || n != 3 {
+			t.Errorf("Count() = %d, %v, want 3", n, err)
+		}
+	})
+
+	t.Run("get by ids", func(t *testing.T) {
+		pp, err := s.GetPersonsByIDs([]uuid.UUID{ann.ID, uuid.NewV4(), joe.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe, ann)
+
+		pp, err = s.GetPersonsByIDs(nil)
+		if err != nil || len(pp) != 0 {
+			t.Errorf("got %v, %v for no ids", pp, err)
+		}
+	})
+
+	t.Run("get by name", func(t *testing.T) {
+		pp, err := s.GetPersonsByName("Joe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe, other)
+
+		if _, err := s.GetPersonsByName("Nobody"); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+	})
+
+	t.Run("get by communication", func(t *testing.T) {
+		pp, err := s.GetPersonsByCommunication("box@mail.ua")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe, ann)
+
+		if _, err := s.GetPersonsByCommunication("nobody@mail.ua"); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		changed := &Person{ID: ann.ID, Name: "Anna", Communications: []*Communication{{"anna@mail.ua"}}}
+		got, err := s.UpdatePerson(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSamePerson(t, got, changed)
+
+		if _, err := s.GetPersonsByCommunication("anna@mail.ua"); err != nil {
+			t.Errorf("new communication not found: %v", err)
+		}
+		pp, _ := s.GetPersonsByCommunication("box@mail.ua")
+		assertPersonIDs(t, pp, joe)
+
+		if _, err := s.UpdatePerson(&Person{ID: uuid.NewV4(), Name: "Nobody"}); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		p, err := s.DeletePerson(joe.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSamePerson(t, p, joe)
+
+		if _, err := s.GetPersonByID(joe.ID); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+		if _, err := s.GetPersonsByCommunication("+380973224562"); err != personNotFoundError {
+			t.Errorf("communications outlived their person: %v", err)
+		}
+		if _, err := s.DeletePerson(joe.ID); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+	})
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persons.db")
+	s, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mode string
+	if err := s.db.Get(&mode, `PRAGMA journal_mode`); err != nil || mode != "wal" {
+		t.Errorf("journal mode = %q, %v, want wal", mode, err)
+	}
+
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe", Communications: []*Communication{{"box@mail.ua"}}}
+	if _, err := s.Add(joe); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("failed write is rolled back", func(t *testing.T) {
+		if _, err := s.UpdatePerson(&Person{ID: uuid.NewV4(), Name: "Nobody"}); err != personNotFoundError {
+			t.Fatalf("err = %v", err)
+		}
+		p, _ := s.GetPersonByID(joe.ID)
+		assertSamePerson(t, p, joe)
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := s.Add(&Person{ID: uuid.NewV4(), Name: "Louis", Communications: []*Communication{{"louis@mail.ua"}}})
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		if pp, _ := s.GetPersonsByName("Louis"); len(pp) != 20 {
+			t.Errorf("got %d persons, want 20", len(pp))
+		}
+	})
+
+	t.Run("survives a restart", func(t *testing.T) {
+		s.Close()
+		s, err = NewSQLiteStorage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		p, err := s.GetPersonByID(joe.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSamePerson(t, p, joe)
+	})
+}
+
+// TestSQLiteManyPersons loads more persons than a statement can bind ids.
+func TestSQLiteManyPersons(t *testing.T) {
+	s, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "persons.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	n := sqliteMaxVariables + 10
+	ids := make([]uuid.UUID, n)
+	tx := s.db.MustBegin()
+	for i := range ids {
+		ids[i] = uuid.NewV4()
+		tx.MustExec(`INSERT INTO person (id, name) VALUES (?, ?)`, ids[i].String(), "Louis")
+		tx.MustExec(`INSERT INTO communication (value, personid) VALUES (?, ?)`, "louis@mail.ua", ids[i].String())
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := map[string]func() ([]*Person, error){
+		"get all":     s.GetAll,
+		"get by ids":  func() ([]*Person, error) { return s.GetPersonsByIDs(ids) },
+		"get by name": func() ([]*Person, error) { return s.GetPersonsByName("Louis") },
+	}
+	for name, load := range loads {
+		t.Run(name, func(t *testing.T) {
+			pp, err := load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pp) != n {
+				t.Fatalf("got %d persons, want %d", len(pp), n)
+			}
+			for _, p := range pp {
+				if len(p.Communications) != 1 {
+					t.Fatalf("%v has communications %v", p.ID, p.Communications)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "persons.bolt")
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexKeys := func(bucket []byte) []string {
+		var keys []string
+		s.db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(bucket).ForEach(func(k, _ []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+		})
+		sort.Strings(keys)
+		return keys
+	}
+	assertIndex := func(t *testing.T, bucket []byte, want ...[]byte) {
+		t.Helper()
+		var w []string
+		for _, k := range want {
+			w = append(w, string(k))
+		}
+		sort.Strings(w)
+		if got := indexKeys(bucket); !reflect.DeepEqual(got, w) {
+			t.Errorf("%s = %q, want %q", bucket, got, w)
+		}
+	}
+
+	joe := &Person{ID: uuid.NewV4(), Name: "Jo", Communications: []*Communication{{"box@mail.ua"}}}
+	// The name starts with joe's name and the separator, it must not show up for "Jo".
+	tricky := &Person{ID: uuid.NewV4(), Name: "Jo\x00e"}
+	s.Add(joe)
+	s.Add(tricky)
+
+	t.Run("prefix lookups are exact", func(t *testing.T) {
+		pp, err := s.GetPersonsByName("Jo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe)
+	})
+
+	t.Run("indexes follow writes", func(t *testing.T) {
+		s.UpdatePerson(&Person{ID: joe.ID, Name: "Joe", Communications: []*Communication{{"joe@mail.ua"}}})
+		assertIndex(t, personsByNameBucket, indexKey("Joe", joe.ID), indexKey(tricky.Name, tricky.ID))
+		assertIndex(t, personsByCommunicationBucket, indexKey("joe@mail.ua", joe.ID))
+
+		if _, err := s.Add(&Person{ID: joe.ID, Name: "Someone", Communications: []*Communication{{"x@mail.ua"}}}); err != personExistError {
+			t.Fatalf("err = %v", err)
+		}
+		assertIndex(t, personsByCommunicationBucket, indexKey("joe@mail.ua", joe.ID))
+
+		s.DeletePerson(tricky.ID)
+		assertIndex(t, personsByNameBucket, indexKey("Joe", joe.ID))
+	})
+
+	t.Run("values longer than a bbolt key", func(t *testing.T) {
+		long := strings.Repeat("x", bolt.MaxKeySize)
+		louis := &Person{ID: uuid.NewV4(), Name: long, Communications: []*Communication{{long + "@mail.ua"}}}
+		if _, err := s.Add(louis); err != nil {
+			t.Fatal(err)
+		}
+		pp, err := s.GetPersonsByName(long)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, louis)
+		if pp, err = s.GetPersonsByCommunication(long + "@mail.ua"); err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, louis)
+		if _, err := s.GetPersonsByName(long + "y"); err != personNotFoundError {
+			t.Errorf("err = %v, want %v", err, personNotFoundError)
+		}
+
+		s.DeletePerson(louis.ID)
+		assertIndex(t, personsByNameBucket, indexKey("Joe", joe.ID))
+	})
+
+	t.Run("survives a restart", func(t *testing.T) {
+		s.Close()
+		s, err = NewBoltStorage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+
+		pp, err := s.GetPersonsByCommunication("joe@mail.ua")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPersonIDs(t, pp, joe)
+	})
+}
+
+func assertSamePerson(t *testing.T, got, want *Person) {
+	t.Helper()
+	if got == nil || !uuid.Equal(got.ID, want.ID) || got.Name != want.Name || len(got.Communications) != len(want.Communications) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i, c := range want.Communications {
+		if got.Communications[i].Value != c.Value {
+			t.Errorf("communication %d = %q, want %q", i, got.Communications[i].Value, c.Value)
+		}
+	}
+}
+
+func assertPersonIDs(t *testing.T, got []*Person, want ...*Person) {
+	t.Helper()
+	ids := func(pp []*Person) []string {
+		var ids []string
+		for _, p := range pp {
+			ids = append(ids, p.ID.String())
+		}
+		sort.Strings(ids)
+		return ids
+	}
+	g, w := ids(got), ids(want)
+	if len(g) != len(w) {
+		t.Fatalf("got persons %v, want %v", g, w)
+	}
+	for i := range g {
+		if g[i] != w[i] {
+			t.Fatalf("got persons %v, want %v", g, w)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// TLSConfig enables HTTPS. With ClientCAFile set, client certificates signed by
+// one of its CAs authenticate the request in place of Basic Auth.
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	// ClientAuth is "require", the default, or "optional" to still let Basic Auth clients in without a certificate.
+	ClientAuth string
+}
+
+// CertReloader serves the certificate and client CAs from disk and picks up
+// changes to the files without a restart, e.g. after a renewal.
+type CertReloader struct {
+	cfg TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	stamps    map[string]fileStamp
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewCertReloader(cfg TLSConfig) (*CertReloader, error) {
+	switch cfg.ClientAuth {
+	case "":
+		cfg.ClientAuth = tlsClientAuthRequire
+	case tlsClientAuthRequire, tlsClientAuthOptional:
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", cfg.ClientAuth)
+	}
+
+	c := &CertReloader{cfg: cfg}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the files again. On error the previous certificate stays in use.
+func (c *CertReloader) Reload() error {
+	stamps, err := c.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if c.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %v", c.cfg.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert, c.clientCAs, c.stamps = &cert, pool, stamps
+	return nil
+}
+
+func (c *CertReloader) stat() (map[string]fileStamp, error) {
+	stamps := make(map[string]fileStamp)
+	for _, name := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		fi, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		stamps[name] = fileStamp{fi.ModTime(), fi.Size()}
+	}
+	return stamps, nil
+}
+
+func (c *CertReloader) changed() bool {
+	stamps, err := c.stat()
+	if err != nil {
+		// A renewal may be replacing the files right now; try again on the next tick.
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for name, stamp := range stamps {
+		if c.stamps[name] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch reloads the files whenever they change, until ctx is done.
+func (c *CertReloader) Watch(ctx context.Context) {
+	ticker := time.NewTicker(tlsReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+			if err := c.Reload(); err != nil {
+				log.Error().Err(err).Msg("could not reload TLS certificate")
+			} else {
+				log.Info().Str("cert", c.cfg.CertFile).Msg("reloaded TLS certificate")
+			}
+		}
+	}
+}
+
+// TLSConfig returns the server configuration. Certificates and CAs are looked
+// up per handshake, so reloads apply to new connections.
+func (c *CertReloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.getCertificate,
+	}
+	if c.cfg.ClientCAFile == "" {
+		return cfg
+	}
+
+	clientAuth := tls.RequireAndVerifyClientCert
+	if c.cfg.ClientAuth == tlsClientAuthOptional {
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: c.getCertificate,
+			ClientAuth:     clientAuth,
+			ClientCAs:      c.clientCAs,
+		}, nil
+	}
+	return cfg
+}
+
+func (c *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// requestIdentity returns who made the request: the identity of a verified
+// client certificate or the Basic Auth user.
+func requestIdentity(r *http.Request) (string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && len(r.TLS.VerifiedChains[0]) != 0 {
+		if id := certificateIdentity(r.TLS.VerifiedChains[0][0]); id != "" {
+			return id, true
+		}
+	}
+	username, password, ok := r.BasicAuth()
+	if ok && authenticate(username, password) {
+		return username, true
+	}
+	return "", false
+}
+
+// certificateIdentity prefers the SANs, which is where SPIFFE IDs, service host
+// names and e-mail addresses live, over the legacy subject common name.
+func certificateIdentity(cert *x509.Certificate) string {
+	switch {
+	case len(cert.URIs) != 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) != 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) != 0:
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"PersonService/personpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate signed by parent, or a self-signed CA when parent is nil.
+func newTestCert(t *testing.T, parent *testCert, template *x509.Certificate) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template.SerialNumber = serial
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert, key}
+}
+
+func (c *testCert) writeFiles(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600)
+	if keyFile != "" {
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "test CA"}})
+	ca.writeFiles(t, caFile, "")
+	serverTemplate := func(name string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:     pkix.Name{CommonName: name},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+	}
+	newTestCert(t, ca, serverTemplate("server 1")).writeFiles(t, certFile, keyFile)
+	spiffeID, _ := url.Parse("spiffe://example.org/billing")
+	client := newTestCert(t, ca, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "billing"},
+		URIs:        []*url.URL{spiffeID},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	other := newTestCert(t, newTestCert(t, nil, &x509.Certificate{Subject: pkix.Name{CommonName: "other CA"}}), &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "intruder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	serve := func(t *testing.T, cfg TLSConfig) (string, *CertReloader) {
+		certs, err := NewCertReloader(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis, err := tls.Listen("tcp", "127.0.0.1:0", certs.TLSConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: NewServer(NewInMemoryPersonStorage(), logBody)}
+		go server.Serve(lis)
+		t.Cleanup(func() { server.Close() })
+		return "https://" + lis.Addr().String(), certs
+	}
+	get := func(url string, cert *testCert, basicAuth bool) (*http.Response, error) {
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		cfg := &tls.Config{RootCAs: roots}
+		if cert != nil {
+			cfg.Certificates = []tls.Certificate{cert.tlsCertificate()}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		req, _ := http.NewRequest("GET", url+"/person", nil)
+		if basicAuth {
+			setRequestAuth(req)
+		}
+		resp, err := c.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	t.Run("client certificate replaces Basic Auth", func(t *testing.T) {
+		url, _ := serve(t, TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+
+		resp, err := get(url, client, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+
+		if _, err := get(url, nil, true); err == nil {
+			t.Error("connection without a client certificate was accepted")
+		}
+		if _, err := get(url, other, true); err == nil {
+			t.Error("client certificate from an unknown CA was accepted")
+		}
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		certs, err := NewCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := NewGRPCServer(NewInMemoryPersonStorage(), grpc.Creds(credentials.NewTLS(certs.TLSConfig())))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		auth := base64.StdEncoding.EncodeToString([]byte(authLogin + ":" + authPassword))
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+auth)
+		call := func(ctx context.Context, creds credentials.TransportCredentials) error {
+			conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(creds))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_, err = personpb.NewPersonServiceClient(conn).Get(ctx, &personpb.GetRequest{Id: "02a883a3-13c4-4624-bbba-edc744f69534"})
+			return err
+		}
+
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.cert)
+		mtls := credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client.tlsCertificate()}})
+		assertCode(t, call(ctx, mtls), codes.NotFound)
+		assertCode(t, call(context.Background(), mtls), codes.NotFound)
+		assertCode(t, call(ctx, credentials.NewTLS(&tls.Config{RootCAs: roots})), codes.Unavailable)
+		assertCode(t, call(ctx, insecure.NewCredentials()), codes.Unavailable)
+
+		optional, err := NewCertReloader(TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: tlsClientAuthOptional})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server = NewGRPCServer(NewInMemoryPersonStorage(), grpc.Creds(credentials.NewTLS(optional.TLSConfig())))
+		go server.Serve(lis)
+		defer server.Stop()
+
+		tlsOnly := credentials.NewTLS(&tls.Config{RootCAs: roots})
+		assertCode(t, call(context.Background(), tlsOnly), codes.Unauthenticated)
+		assertCode(t, call(ctx, tlsOnly), codes.NotFound)
+		assertCode(t, call(context.Background(), mtls), codes.NotFound)
+	})
+
+	t.Run("optional client certificate", func(t *testing.T) {
+		url, _ := serve(t, TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: tlsClientAuthOptional})
+
+		resp, err := get(url, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, resp.StatusCode, http.StatusNotFound)
+
+		resp, err = get(url, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertStatus(t, resp.StatusCode, http.StatusUnauthorized)
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		url, certs := serve(t, TLSConfig{CertFile: certFile, KeyFile: keyFile})
+		if certs.changed() {
+			t.Fatal("files reported as changed before they were touched")
+		}
+
+		renewed := newTestCert(t, ca, serverTemplate("server 2"))
+		renewed.writeFiles(t, certFile, keyFile)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, later, later)
+		if !certs.changed() {
+			t.Fatal("renewed certificate not detected")
+		}
+		if err := certs.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		conn, err := tls.Dial("tcp", url[len("https://"):], &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if got := conn.ConnectionState().PeerCertificates[0].Subject.CommonName; got != "server 2" {
+			t.Errorf("served %q, want the renewed certificate", got)
+		}
+	})
+
+	t.Run("broken files keep the old certificate", func(t *testing.T) {
+		_, certs := serve(t, TLSConfig{CertFile: certFile, KeyFile: keyFile})
+		before, _ := certs.getCertificate(nil)
+
+		os.WriteFile(keyFile, []byte("not a key"), 0600)
+		if err := certs.Reload(); err == nil {
+			t.Error("reload of a broken key succeeded")
+		}
+		if after, _ := certs.getCertificate(nil); after != before {
+			t.Error("certificate replaced after a failed reload")
+		}
+	})
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	spiffeID, _ := url.Parse("spiffe://example.org/billing")
+	tests := []struct {
+		cert *x509.Certificate
+		want string
+	}{
+		{&x509.Certificate{URIs: []*url.URL{spiffeID}, DNSNames: []string{"billing.local"}}, "spiffe://example.org/billing"},
+		{&x509.Certificate{DNSNames: []string{"billing.local"}, Subject: pkix.Name{CommonName: "billing"}}, "billing.local"},
+		{&x509.Certificate{EmailAddresses: []string{"ops@example.org"}}, "ops@example.org"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}, "billing"},
+	}
+	for _, tt := range tests {
+		if got := certificateIdentity(tt.cert); got != tt.want {
+			t.Errorf("certificateIdentity() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TraceExporterOTLP   = "otlp"
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file"
+)
+
+// tracer is resolved through the global provider, so spans are no-ops until
+// NewTracerProvider has been installed with otel.SetTracerProvider.
+var tracer = otel.Tracer(tracerName)
+
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+type TracingConfig struct {
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector address, OTEL_EXPORTER_OTLP_ENDPOINT is used when empty.
+	Endpoint string
+	File     string
+}
+
+// NewTracerProvider builds a batching provider for the configured exporter. The returned
+// shutdown flushes pending spans and releases the exporter.
+func NewTracerProvider(ctx context.Context, cfg TracingConfig) (*sdktrace.TracerProvider, func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	closeFile := func() error { return nil }
+
+	switch cfg.Exporter {
+	case TraceExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter = e
+	case TraceExporterStdout:
+		e, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter = e
+	case TraceExporterFile:
+		f, err := os.OpenFile(cfg.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		exporter = e
+		closeFile = f.Close
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tracerName))),
+	)
+	shutdown := func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if ferr := closeFile(); err == nil {
+			err = ferr
+		}
+		return err
+	}
+	return provider, shutdown, nil
+}
+
+// tracing starts the server span of a request, continuing the trace of an incoming traceparent header.
+func (s *Server) tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		_, route := s.mux.Handler(r)
+		ctx, span := tracer.Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+			))
+		defer span.End()
+
+		lrw := NewLoggingResponseWriter(w, false)
+		next.ServeHTTP(lrw, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(lrw.statusCode))
+		if lrw.statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(lrw.statusCode))
+		}
+	})
+}
+
+// traced runs the handler in its own span.
+func traced(name string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracer.Start(r.Context(), name)
+		defer span.End()
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// TracingStorage records a span for every storage call. Storage has no context
+// parameters, so callers bind the request context with storageWithContext.
+type TracingStorage struct {
+	Storage
+	ctx   context.Context
+	attrs []attribute.KeyValue
+}
+
+func NewTracingStorage(storage Storage, backend string) *TracingStorage {
+	var attrs []attribute.KeyValue
+	switch backend {
+	case "postgres":
+		attrs = []attribute.KeyValue{semconv.DBSystemNamePostgreSQL, semconv.DBCollectionName("person")}
+	case "mongo":
+		attrs = []attribute.KeyValue{semconv.DBSystemNameMongoDB, semconv.DBNamespace(dbName), semconv.DBCollectionName(collectionName)}
+	default:
+		attrs = []attribute.KeyValue{semconv.DBSystemNameKey.String(backend)}
+	}
+	return &TracingStorage{Storage: storage, ctx: context.Background(), attrs: attrs}
+}
+
+func (s *TracingStorage) WithContext(ctx context.Context) Storage {
+	res := *s
+	res.ctx = ctx
+	return &res
+}
+
+// storageWithContext binds ctx to the storage, when it or the storages it wraps take one.
+func storageWithContext(storage Storage, ctx context.Context) Storage {
+	if s, ok := storage.(interface {
+		WithContext(context.Context) Storage
+	}); ok {
+		return s.WithContext(ctx)
+	}
+	return storage
+}
+
+// start opens the span of a call and returns the wrapped storage bound to it, so
+// the backend runs under the request context and its spans nest under this one.
+func (s *TracingStorage) start(method string) (Storage, trace.Span) {
+	ctx, span := tracer.Start(s.ctx, "storage."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(s.attrs...),
+		trace.WithAttributes(semconv.DBOperationName(method)))
+	return storageWithContext(s.Storage, ctx), span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != personNotFoundError {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (s *TracingStorage) GetAll() ([]*Person, error) {
+	storage, span := s.start("GetAll")
+	pp, err := storage.GetAll()
+	endSpan(span, err)
+	return pp, err
+}
+
+func (s *TracingStorage) Add(p *Person) (*Person, error) {
+	storage, span := s.start("Add")
+	res, err := storage.Add(p)
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *TracingStorage) GetPersonByID(id uuid.UUID) (*Person, error) {
+	storage, span := s.start("GetPersonByID")
+	p, err := storage.GetPersonByID(id)
+	endSpan(span, err)
+	return p, err
+}
+
+func (s *TracingStorage) GetPersonsByIDs(ids []uuid.UUID) ([]*Person, error) {
+	storage, span := s.start("GetPersonsByIDs")
+	pp, err := storage.GetPersonsByIDs(ids)
+	endSpan(span, err)
+	return pp, err
+}
+
+func (s *TracingStorage) GetPersonsByName(name string) ([]*Person, error) {
+	storage, span := s.start("GetPersonsByName")
+	pp, err := storage.GetPersonsByName(name)
+	endSpan(span, err)
+	return pp, err
+}
+
+func (s *TracingStorage) GetPersonsByCommunication(value string) ([]*Person, error) {
+	storage, span := s.start("GetPersonsByCommunication")
+	pp, err := storage.GetPersonsByCommunication(value)
+	endSpan(span, err)
+	return pp, err
+}
+
+func (s *TracingStorage) UpdatePerson(p *Person) (*Person, error) {
+	storage, span := s.start("UpdatePerson")
+	res, err := storage.UpdatePerson(p)
+	endSpan(span, err)
+	return res, err
+}
+
+func (s *TracingStorage) DeletePerson(id uuid.UUID) (*Person, error) {
+	storage, span := s.start("DeletePerson")
+	p, err := storage.DeletePerson(id)
+	endSpan(span, err)
+	return p, err
+}
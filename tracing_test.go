@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	storage := NewInMemoryPersonStorage()
+	storage.Add(&Person{ID: uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"), Name: "Joe", Communications: []*Communication{{Value: "box@mail.ua"}}})
+	server := NewServer(NewTracingStorage(storage, "postgres"), logBody)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/person?name=Joe&communication=box@mail.ua", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	setRequestAuth(req)
+	response := httptest.NewRecorder()
+
+	server.ServeHTTP(response, req)
+	assertStatus(t, response.Code, http.StatusOK)
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		if span.SpanContext.TraceID().String() != traceID {
+			t.Errorf("span %q is not part of the incoming trace", span.Name)
+		}
+		spans[span.Name] = span
+	}
+	for _, name := range []string{
+		"GET /person", "requestAuthentication", "personHandler", "searchPersons", "exceptPersons",
+		"storage.GetPersonsByName", "storage.GetPersonsByCommunication",
+	} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("no %q span, got %v", name, spanNames(spans))
+		}
+	}
+
+	if span := spans["GET /person"]; span.SpanKind != trace.SpanKindServer || !hasAttribute(span, semconv.HTTPResponseStatusCode(http.StatusOK)) {
+		t.Errorf("unexpected server span %+v", span)
+	}
+	db := spans["storage.GetPersonsByName"]
+	if !hasAttribute(db, semconv.DBSystemNamePostgreSQL) || !hasAttribute(db, semconv.DBOperationName("GetPersonsByName")) {
+		t.Errorf("storage span has no db attributes: %v", db.Attributes)
+	}
+	if db.Parent.SpanID() != spans["searchPersons"].SpanContext.SpanID() {
+		t.Error("storage span is not a child of searchPersons")
+	}
+}
+
+// contextStorage records the context it was bound to last.
+type contextStorage struct {
+	Storage
+	ctx *context.Context
+}
+
+func (s *contextStorage) WithContext(ctx context.Context) Storage {
+	*s.ctx = ctx
+	return s
+}
+
+func TestStorageContext(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+
+	var bound context.Context
+	var storage Storage = &contextStorage{Storage: NewInMemoryPersonStorage(), ctx: &bound}
+	storage = NewResilientStorage(storage, DefaultResilienceConfig())
+	storage = NewMetricsStorage(storage, "postgres", NewMetrics())
+	storage = NewCachingStorage(storage, CacheConfig{Size: 10, TTL: time.Minute})
+	storage = NewEventStorage(storage)
+	storage = NewTracingStorage(storage, "postgres")
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "request")
+	storageWithContext(storage, ctx).GetPersonByID(uuid.NewV4())
+
+	if bound == nil || bound.Value(key{}) != "request" {
+		t.Fatal("the backend doesn't run under the request context")
+	}
+	if span, ok := trace.SpanFromContext(bound).(sdktrace.ReadOnlySpan); !ok || span.Name() != "storage.GetPersonByID" {
+		t.Errorf("the backend doesn't run under the storage span, got %v", trace.SpanFromContext(bound))
+	}
+}
+
+func hasAttribute(span tracetest.SpanStub, kv attribute.KeyValue) bool {
+	for _, attr := range span.Attributes {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+func spanNames(spans map[string]tracetest.SpanStub) []string {
+	var names []string
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PersistenceConfig makes InMemoryPersonStorage durable. Every write is appended
+// to a log in Dir before it is applied, and snapshots of the whole data set let
+// the log start over, so a restart only replays the writes since the last one.
+type PersistenceConfig struct {
+	Dir string
+	// Sync is "always" to fsync before a write returns, "interval" to fsync every
+	// SyncInterval, or "never" to leave it to the OS. With anything but "always" a
+	// machine crash, though not a process crash, can lose the latest writes.
+	Sync             string
+	SyncInterval     time.Duration
+	SnapshotInterval time.Duration
+}
+
+func DefaultPersistenceConfig() PersistenceConfig {
+	return PersistenceConfig{
+		Sync:             walSyncInterval,
+		SyncInterval:     defaultWALSyncInterval,
+		SnapshotInterval: defaultSnapshotInterval,
+	}
+}
+
+const (
+	walOpPut    = "put"
+	walOpDelete = "delete"
+
+	walHeaderSize = 8
+	snapshotFile  = "snapshot.json"
+)
+
+var walChecksum = crc32.MakeTable(crc32.Castagnoli)
+
+type walRecord struct {
+	Seq    uint64    `json:"seq"`
+	Op     string    `json:"op"`
+	ID     uuid.UUID `json:"id"`
+	Person *Person   `json:"person,omitempty"`
+}
+
+type snapshot struct {
+	Seq     uint64    `json:"seq"`
+	Persons []*Person `json:"persons"`
+}
+
+// writeAheadLog writes records to segment files named after their first sequence
+// number. Each record is framed by its length and a CRC, so recovery can tell a
+// record cut short by a crash from a complete one.
+type writeAheadLog struct {
+	dir    string
+	policy string
+
+	mu      sync.Mutex
+	file    *os.File
+	first   uint64 // sequence number of the first record in file
+	offset  int64
+	seq     uint64
+	dirty   bool
+	snapped uint64
+	err     error
+}
+
+// openWAL recovers the data from the latest snapshot and the log after it, and
+// opens the log for appending.
+func openWAL(cfg PersistenceConfig) (*writeAheadLog, map[uuid.UUID]*Person, error) {
+	switch cfg.Sync {
+	case walSyncAlways, walSyncInterval, walSyncNever:
+	case "":
+		cfg.Sync = walSyncInterval
+	default:
+		return nil, nil, fmt.Errorf("unknown WAL sync policy %q", cfg.Sync)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, nil, err
+	}
+
+	l := &writeAheadLog{dir: cfg.Dir, policy: cfg.Sync}
+	data, err := l.loadSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	segments, err := l.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, first := range segments {
+		offset, err := l.replay(first, data)
+		if err == nil {
+			continue
+		}
+		if i != len(segments)-1 {
+			return nil, nil, fmt.Errorf("%v: %w", l.segmentPath(first), err)
+		}
+		// Only the last record can be incomplete, it was being written when the process died.
+		log.Warn().Err(err).Str("segment", l.segmentPath(first)).Int64("offset", offset).Msg("dropping incomplete WAL record")
+		if err := os.Truncate(l.segmentPath(first), offset); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if len(segments) != 0 {
+		last := segments[len(segments)-1]
+		if l.file, err = os.OpenFile(l.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return nil, nil, err
+		}
+		fi, err := l.file.Stat()
+		if err != nil {
+			l.file.Close()
+			return nil, nil, err
+		}
+		l.first, l.offset = last, fi.Size()
+	} else if err := l.create(l.seq + 1); err != nil {
+		return nil, nil, err
+	}
+	return l, data, nil
+}
+
+func (l *writeAheadLog) segmentPath(first uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("wal-%016x.log", first))
+}
+
+// segments returns the first sequence numbers of the segment files in order.
+func (l *writeAheadLog) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, "wal-") || !strings.HasSuffix(name, ".log") {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "wal-"), ".log"), 16, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, first)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+func (l *writeAheadLog) loadSnapshot() (map[uuid.UUID]*Person, error) {
+	data := make(map[uuid.UUID]*Person)
+	raw, err := os.ReadFile(filepath.Join(l.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return nil, fmt.Errorf("%v: %w", snapshotFile, err)
+	}
+	for _, p := range snap.Persons {
+		data[p.ID] = p
+	}
+	l.seq, l.snapped = snap.Seq, snap.Seq
+	return data, nil
+}
+
+// replay applies the records of a segment that aren't in the snapshot yet. On
+// error it returns the offset after the last good record.
+func (l *writeAheadLog) replay(first uint64, data map[uuid.UUID]*Person) (int64, error) {
+	raw, err := os.ReadFile(l.segmentPath(first))
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	for len(raw) != 0 {
+		if len(raw) < walHeaderSize {
+			return offset, errors.New("truncated record header")
+		}
+		size := binary.LittleEndian.Uint32(raw)
+		sum := binary.LittleEndian.Uint32(raw[4:])
+		if uint64(len(raw)-walHeaderSize) < uint64(size) {
+			return offset, errors.New("truncated record")
+		}
+		payload := raw[walHeaderSize : walHeaderSize+size]
+		if crc32.Checksum(payload, walChecksum) != sum {
+			return offset, errors.New("record checksum mismatch")
+		}
+		var rec walRecord
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return offset, err
+		}
+
+		if rec.Seq > l.seq {
+			switch rec.Op {
+			case walOpPut:
+				data[rec.ID] = rec.Person
+			case walOpDelete:
+				delete(data, rec.ID)
+			}
+			l.seq = rec.Seq
+		}
+		raw = raw[walHeaderSize+size:]
+		offset += int64(walHeaderSize + size)
+	}
+	return offset, nil
+}
+
+func (l *writeAheadLog) create(first uint64) error {
+	f, err := os.OpenFile(l.segmentPath(first), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.first, l.offset = f, first, 0
+	return nil
+}
+
+func (l *writeAheadLog) put(p *Person) error {
+	if l == nil {
+		return nil
+	}
+	return l.append(&walRecord{Op: walOpPut, ID: p.ID, Person: p})
+}
+
+func (l *writeAheadLog) delete(id uuid.UUID) error {
+	if l == nil {
+		return nil
+	}
+	return l.append(&walRecord{Op: walOpDelete, ID: id})
+}
+
+func (l *writeAheadLog) append(rec *walRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+
+	rec.Seq = l.seq + 1
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, walHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(buf, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, walChecksum))
+	copy(buf[walHeaderSize:], payload)
+
+	if _, err := l.file.Write(buf); err != nil {
+		// Cut off what made it to the file, or the next records would follow a broken one.
+		if truncErr := l.file.Truncate(l.offset); truncErr != nil {
+			l.err = fmt.Errorf("WAL is unusable after a failed write: %w", err)
+		}
+		return err
+	}
+	if l.policy == walSyncAlways {
+		if err := l.file.Sync(); err != nil {
+			// After a failed fsync the kernel may have dropped the pages, nothing written since can be trusted.
+			l.err = fmt.Errorf("WAL is unusable after a failed sync: %w", err)
+			return err
+		}
+	} else {
+		l.dirty = true
+	}
+	l.seq = rec.Seq
+	l.offset += int64(len(buf))
+	return nil
+}
+
+func (l *writeAheadLog) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.dirty || l.err != nil {
+		return l.err
+	}
+	if err := l.file.Sync(); err != nil {
+		l.err = fmt.Errorf("WAL is unusable after a failed sync: %w", err)
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// rotate starts a new segment after the last record, so the segments before it
+// can be removed once a snapshot covers them. It returns the last sequence number.
+func (l *writeAheadLog) rotate() (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.first == l.seq+1 {
+		return l.seq, nil
+	}
+	if err := l.file.Sync(); err != nil {
+		l.err = fmt.Errorf("WAL is unusable after a failed sync: %w", err)
+		return 0, err
+	}
+	l.dirty = false
+	old := l.file
+	if err := l.create(l.seq + 1); err != nil {
+		return 0, err
+	}
+	return l.seq, old.Close()
+}
+
+// writeSnapshot stores the persons as of seq and removes the segments it makes obsolete.
+func (l *writeAheadLog) writeSnapshot(seq uint64, persons []*Person) error {
+	data, err := json.Marshal(snapshot{Seq: seq, Persons: persons})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(l.dir, snapshotFile)
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	if err := syncDir(l.dir); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.snapped = seq
+	l.mu.Unlock()
+
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+	for _, first := range segments {
+		if first <= seq {
+			if err := os.Remove(l.segmentPath(first)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// changedSinceSnapshot tells whether a new snapshot would differ from the last one.
+func (l *writeAheadLog) changedSinceSnapshot() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.seq != l.snapped
+}
+
+func (l *writeAheadLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.file.Sync(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// syncDir makes a created or renamed file in dir survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+func openPersistent(t *testing.T, dir string) *InMemoryPersonStorage {
+	t.Helper()
+	s, err := OpenInMemoryPersonStorage(PersistenceConfig{Dir: dir, Sync: walSyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// crash closes the log without the snapshot Close would write.
+func crash(t *testing.T, s *InMemoryPersonStorage) {
+	t.Helper()
+	if err := s.log.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func walSegments(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "wal-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestPersistentInMemoryStorage(t *testing.T) {
+	joe := &Person{ID: uuid.NewV4(), Name: "Joe", Communications: []*Communication{{"box@mail.ua"}}}
+	ann := &Person{ID: uuid.NewV4(), Name: "Ann"}
+	louis := &Person{ID: uuid.NewV4(), Name: "Louis"}
+
+	t.Run("recovers from the log", func(t *testing.T) {
+		dir := t.TempDir()
+		s := openPersistent(t, dir)
+		s.Add(joe)
+		s.Add(ann)
+		s.UpdatePerson(&Person{ID: ann.ID, Name: "Anna"})
+		s.Add(louis)
+		s.DeletePerson(louis.ID)
+		crash(t, s)
+
+		s = openPersistent(t, dir)
+		defer s.Close()
+		p, err := s.GetPersonByID(joe.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertSamePerson(t, p, joe)
+		if p, _ := s.GetPersonByID(ann.ID); p == nil || p.Name != "Anna" {
+			t.Errorf("update lost, got %v", p)
+		}
+		if _, err := s.GetPersonByID(louis.ID); err != personNotFoundError {
+			t.Errorf("delete lost, err = %v", err)
+		}
+	})
+
+	t.Run("recovers from a snapshot and the log after it", func(t *testing.T) {
+		dir := t.TempDir()
+		s := openPersistent(t, dir)
+		s.Add(joe)
+		s.Add(ann)
+		if err := s.Snapshot(); err != nil {
+			t.Fatal(err)
+		}
+		if segments := walSegments(t, dir); len(segments) != 1 {
+			t.Errorf("segments after snapshot = %v, want only the new one", segments)
+		}
+		s.DeletePerson(ann.ID)
+		s.Add(louis)
+		crash(t, s)
+
+		s = openPersistent(t, dir)
+		defer s.Close()
+		pp, _ := s.GetAll()
+		assertPersonIDs(t, pp, joe, louis)
+	})
+
+	t.Run("close writes a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		s := openPersistent(t, dir)
+		s.Add(joe)
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+			t.Fatal(err)
+		}
+
+		s = openPersistent(t, dir)
+		defer s.Close()
+		if _, err := s.GetPersonByID(joe.ID); err != nil {
+			t.Error(err)
+		}
+	})
+
+	for name, tail := range map[string][]byte{
+		"truncated header": {0x2a, 0x00},
+		"truncated record": {0xff, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, '{'},
+		"bad checksum":     {0x02, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x04, '{', '}'},
+	} {
+		t.Run("drops a "+name, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openPersistent(t, dir)
+			s.Add(joe)
+			crash(t, s)
+
+			segments := walSegments(t, dir)
+			f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Write(tail)
+			f.Close()
+
+			s = openPersistent(t, dir)
+			if _, err := s.GetPersonByID(joe.ID); err != nil {
+				t.Fatal(err)
+			}
+			// New records must not end up behind the broken one.
+			s.Add(ann)
+			crash(t, s)
+
+			s = openPersistent(t, dir)
+			defer s.Close()
+			pp, _ := s.GetAll()
+			assertPersonIDs(t, pp, joe, ann)
+		})
+	}
+
+	t.Run("unknown sync policy", func(t *testing.T) {
+		if _, err := OpenInMemoryPersonStorage(PersistenceConfig{Dir: t.TempDir(), Sync: "sometimes"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
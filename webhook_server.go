@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	webhooksPath    = "/webhooks"
+	deadLettersPath = "/webhooks/dead-letters"
+)
+
+func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentTypeJSON)
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == webhooksPath && r.Method == http.MethodGet:
+		s.getSubscriptions(w, r)
+	case path == webhooksPath && r.Method == http.MethodPost:
+		s.addSubscription(w, r)
+	case path == deadLettersPath && r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(s.webhooks.store.DeadLetters())
+	case strings.HasPrefix(path, deadLettersPath+"/") && r.Method == http.MethodPost:
+		s.replayDeadLetter(w, r)
+	case strings.HasPrefix(path, webhooksPath+"/") && r.Method == http.MethodDelete:
+		s.deleteSubscription(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) getSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs := []*WebhookSubscription{}
+	for _, sub := range s.webhooks.store.Subscriptions() {
+		copied := *sub
+		copied.Secret = ""
+		subs = append(subs, &copied)
+	}
+	json.NewEncoder(w).Encode(subs)
+}
+
+func (s *Server) addSubscription(w http.ResponseWriter, r *http.Request) {
+	if !isContentTypeJSON(r) {
+		handleError(wrongContentTypeError, w, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	sub := &WebhookSubscription{}
+	if err := s.decodeJSON(w, r, sub); err != nil {
+		handleError(err, w, decodeStatus(err))
+		return
+	}
+
+	sub, err := s.webhooks.Subscribe(sub)
+	if err == notValidSubscriptionError {
+		handleError(err, w, http.StatusBadRequest)
+		return
+	} else if err == subscriptionExistError {
+		handleError(err, w, http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		handleError(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+func (s *Server) deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.FromString(strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), webhooksPath+"/"))
+	if err != nil {
+		handleError(invalidUuidError, w, http.StatusBadRequest)
+		return
+	}
+
+	err = s.webhooks.store.DeleteSubscription(id)
+	if err == subscriptionNotFoundError {
+		handleError(err, w, http.StatusNotFound)
+	} else if err != nil {
+		handleError(err, w, http.StatusInternalServerError)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// replayDeadLetter handles POST /webhooks/dead-letters/{id}/replay.
+func (s *Server) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(strings.TrimSuffix(r.URL.Path, "/"), deadLettersPath+"/")
+	idStr = strings.TrimSuffix(idStr, "/replay")
+	id, err := uuid.FromString(idStr)
+	if err != nil {
+		handleError(invalidUuidError, w, http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := s.webhooks.Replay(id)
+	if err == deliveryNotFoundError {
+		handleError(err, w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		handleError(err, w, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
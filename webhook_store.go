@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// WebhookStore keeps subscriptions, pending deliveries and dead letters.
+// With a non-empty path every change is flushed to disk so the queue survives restarts.
+type WebhookStore struct {
+	mu    sync.Mutex
+	path  string
+	state webhookState
+}
+
+type webhookState struct {
+	Subscriptions map[uuid.UUID]*WebhookSubscription `json:"subscriptions"`
+	Pending       map[uuid.UUID]*WebhookDelivery     `json:"pending"`
+	DeadLetters   map[uuid.UUID]*WebhookDelivery     `json:"dead_letters"`
+}
+
+func NewWebhookStore(path string) (*WebhookStore, error) {
+	s := &WebhookStore{
+		path: path,
+		state: webhookState{
+			Subscriptions: make(map[uuid.UUID]*WebhookSubscription),
+			Pending:       make(map[uuid.UUID]*WebhookDelivery),
+			DeadLetters:   make(map[uuid.UUID]*WebhookDelivery),
+		},
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *WebhookStore) Subscriptions() []*WebhookSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs := []*WebhookSubscription{}
+	for _, sub := range s.state.Subscriptions {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+func (s *WebhookStore) Subscription(id uuid.UUID) (*WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.state.Subscriptions[id]
+	if !ok {
+		return nil, subscriptionNotFoundError
+	}
+	return sub, nil
+}
+
+func (s *WebhookStore) AddSubscription(sub *WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Subscriptions[sub.ID]; ok {
+		return subscriptionExistError
+	}
+	s.state.Subscriptions[sub.ID] = sub
+	return s.flush()
+}
+
+func (s *WebhookStore) DeleteSubscription(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Subscriptions[id]; !ok {
+		return subscriptionNotFoundError
+	}
+	delete(s.state.Subscriptions, id)
+	for deliveryID, d := range s.state.Pending {
+		if d.SubscriptionID == id {
+			delete(s.state.Pending, deliveryID)
+		}
+	}
+	return s.flush()
+}
+
+func (s *WebhookStore) Enqueue(deliveries ...*WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, d := range deliveries {
+		s.state.Pending[d.ID] = d
+	}
+	return s.flush()
+}
+
+// Pending returns the queued deliveries ordered by their next attempt time.
+func (s *WebhookStore) Pending() []*WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedDeliveries(s.state.Pending)
+}
+
+func (s *WebhookStore) Complete(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.state.Pending, id)
+	return s.flush()
+}
+
+func (s *WebhookStore) Reschedule(d *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.state.Pending[d.ID]; !ok {
+		return nil
+	}
+	s.state.Pending[d.ID] = d
+	return s.flush()
+}
+
+func (s *WebhookStore) Bury(d *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.state.Pending, d.ID)
+	s.state.DeadLetters[d.ID] = d
+	return s.flush()
+}
+
+func (s *WebhookStore) DeadLetters() []*WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedDeliveries(s.state.DeadLetters)
+}
+
+// Revive moves a dead letter back to the pending queue.
+func (s *WebhookStore) Revive(id uuid.UUID, now time.Time) (*WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delivery, ok := s.state.DeadLetters[id]
+	if !ok {
+		return nil, deliveryNotFoundError
+	}
+	delivery.Attempts = 0
+	delivery.LastError = ""
+	delivery.NextAttempt = now
+	delete(s.state.DeadLetters, id)
+	s.state.Pending[id] = delivery
+	return delivery, s.flush()
+}
+
+func (s *WebhookStore) flush() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), os.FileMode(0755)); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func sortedDeliveries(m map[uuid.UUID]*WebhookDelivery) []*WebhookDelivery {
+	dd := []*WebhookDelivery{}
+	for _, d := range m {
+		copied := *d
+		dd = append(dd, &copied)
+	}
+	sort.Slice(dd, func(i, j int) bool { return dd[i].NextAttempt.Before(dd[j].NextAttempt) })
+	return dd
+}
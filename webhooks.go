@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	uuid "github.com/satori/go.uuid"
+)
+
+type WebhookSubscription struct {
+	ID                 uuid.UUID         `json:"id"`
+	URL                string            `json:"url"`
+	Secret             string            `json:"secret,omitempty"`
+	Events             []PersonEventType `json:"events,omitempty"`
+	CommunicationKinds []string          `json:"communication_kinds,omitempty"`
+	CreatedAt          time.Time         `json:"created_at"`
+}
+
+// Matches reports whether the event passes the subscription filter.
+// Empty filters match everything.
+func (sub *WebhookSubscription) Matches(e *PersonEvent) bool {
+	if len(sub.Events) != 0 {
+		found := false
+		for _, t := range sub.Events {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(sub.CommunicationKinds) == 0 {
+		return true
+	}
+	if e.Person == nil {
+		return false
+	}
+	for _, comm := range e.Person.Communications {
+		for _, kind := range sub.CommunicationKinds {
+			if comm.Kind() == kind {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID    `json:"id"`
+	SubscriptionID uuid.UUID    `json:"subscription_id"`
+	Event          *PersonEvent `json:"event"`
+	Attempts       int          `json:"attempts"`
+	NextAttempt    time.Time    `json:"next_attempt"`
+	LastError      string       `json:"last_error,omitempty"`
+}
+
+// WebhookDispatcher turns person events into signed HTTP deliveries.
+// Failed deliveries are retried with exponential backoff and end up in the
+// dead-letter list after maxAttempts.
+type WebhookDispatcher struct {
+	store        *WebhookStore
+	client       *http.Client
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+
+	wake   chan struct{}
+	stop   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewWebhookDispatcher(store *WebhookStore) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		store:        store,
+		client:       &http.Client{Timeout: webhookTimeout},
+		maxAttempts:  webhookMaxAttempts,
+		baseBackoff:  webhookBaseBackoff,
+		maxBackoff:   webhookMaxBackoff,
+		pollInterval: webhookPollInterval,
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+func (d *WebhookDispatcher) Subscribe(sub *WebhookSubscription) (*WebhookSubscription, error) {
+	if u, err := url.Parse(sub.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, notValidSubscriptionError
+	}
+	if uuid.Equal(sub.ID, uuid.Nil) {
+		sub.ID = uuid.NewV4()
+	}
+	if sub.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+	sub.CreatedAt = time.Now().UTC()
+
+	if err := d.store.AddSubscription(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Publish enqueues a delivery for every subscription interested in the event.
+// It satisfies EventListener.
+func (d *WebhookDispatcher) Publish(e *PersonEvent) {
+	now := time.Now().UTC()
+
+	var deliveries []*WebhookDelivery
+	for _, sub := range d.store.Subscriptions() {
+		if !sub.Matches(e) {
+			continue
+		}
+		deliveries = append(deliveries, &WebhookDelivery{
+			ID:             uuid.NewV4(),
+			SubscriptionID: sub.ID,
+			Event:          e,
+			NextAttempt:    now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.store.Enqueue(deliveries...); err != nil {
+		log.Error().Err(err).Str("event_id", e.ID.String()).Msg("webhooks: could not enqueue event")
+		return
+	}
+	d.notify()
+}
+
+func (d *WebhookDispatcher) Replay(id uuid.UUID) (*WebhookDelivery, error) {
+	delivery, err := d.store.Revive(id, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+func (d *WebhookDispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+		for {
+			d.deliverDue(ctx, time.Now().UTC())
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Stop lets the deliveries in flight finish until ctx is done and cancels the
+// rest. Cancelled deliveries stay pending without using up an attempt.
+func (d *WebhookDispatcher) Stop(ctx context.Context) error {
+	close(d.stop)
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+func (d *WebhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue sends the due deliveries. Subscriptions are served concurrently by up
+// to webhookWorkers workers, so a slow receiver only holds up its own deliveries.
+// A subscription gets its events in order: a failed delivery holds back the ones
+// published after it until it is delivered or dead-lettered.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context, now time.Time) {
+	var order []uuid.UUID
+	queued := make(map[uuid.UUID][]*WebhookDelivery)
+	for _, delivery := range d.store.Pending() {
+		if _, ok := queued[delivery.SubscriptionID]; !ok {
+			order = append(order, delivery.SubscriptionID)
+		}
+		queued[delivery.SubscriptionID] = append(queued[delivery.SubscriptionID], delivery)
+	}
+
+	subscriptions := make(chan uuid.UUID)
+	var wg sync.WaitGroup
+	for i := 0; i < min(webhookWorkers, len(order)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range subscriptions {
+				deliveries := queued[id]
+				sort.SliceStable(deliveries, func(i, j int) bool {
+					return deliveries[i].Event.Time.Before(deliveries[j].Event.Time)
+				})
+				for _, delivery := range deliveries {
+					if ctx.Err() != nil || delivery.NextAttempt.After(now) || !d.attempt(ctx, delivery, now) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	for _, id := range order {
+		subscriptions <- id
+	}
+	close(subscriptions)
+	wg.Wait()
+}
+
+// attempt reports whether the delivery left the queue.
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery *WebhookDelivery, now time.Time) bool {
+	sub, err := d.store.Subscription(delivery.SubscriptionID)
+	if err != nil {
+		d.store.Complete(delivery.ID)
+		return true
+	}
+
+	err = d.deliver(ctx, sub, delivery)
+	if err == nil {
+		if err := d.store.Complete(delivery.ID); err != nil {
+			log.Error().Err(err).Str("delivery_id", delivery.ID.String()).Msg("webhooks: could not complete delivery")
+		}
+		return true
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	buried := delivery.Attempts >= d.maxAttempts
+	if buried {
+		err = d.store.Bury(delivery)
+	} else {
+		delivery.NextAttempt = now.Add(d.backoff(delivery.Attempts))
+		err = d.store.Reschedule(delivery)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("delivery_id", delivery.ID.String()).Msg("webhooks: could not update delivery")
+	}
+	return buried
+}
+
+func (d *WebhookDispatcher) deliver(ctx context.Context, sub *WebhookSubscription, delivery *WebhookDelivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeJSON)
+	req.Header.Set(webhookEventHeader, string(delivery.Event.Type))
+	req.Header.Set(webhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(sub.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *WebhookDispatcher) backoff(attempts int) time.Duration {
+	backoff := d.baseBackoff << uint(attempts-1)
+	if backoff <= 0 || backoff > d.maxBackoff {
+		return d.maxBackoff
+	}
+	return backoff
+}
+
+// signWebhookPayload returns the value of the signature header: "sha256=" followed
+// by the hex encoded HMAC-SHA256 of the body keyed with the subscription secret.
+func signWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
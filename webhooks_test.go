@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type webhookReceiver struct {
+	mu        sync.Mutex
+	status    int
+	bodies    [][]byte
+	signature []string
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.bodies = append(rec.bodies, body)
+	rec.signature = append(rec.signature, r.Header.Get(webhookSignatureHeader))
+	w.WriteHeader(rec.status)
+}
+
+func (rec *webhookReceiver) received() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.bodies)
+}
+
+func TestWebhooks(t *testing.T) {
+	joe := &Person{
+		ID:             uuid.FromStringOrNil("02a883a3-13c4-4624-bbba-edc744f69534"),
+		Name:           "Joe",
+		Communications: []*Communication{{Value: "box@mail.ua"}},
+	}
+
+	t.Run("signed delivery", func(t *testing.T) {
+		rec := &webhookReceiver{status: http.StatusOK}
+		receiver := httptest.NewServer(rec)
+		defer receiver.Close()
+
+		store, _ := NewWebhookStore("")
+		d := NewWebhookDispatcher(store)
+		sub, err := d.Subscribe(&WebhookSubscription{URL: receiver.URL, Secret: "secret"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		storage := NewEventStorage(NewInMemoryPersonStorage(), d.Publish)
+		storage.Add(joe)
+		d.deliverDue(context.Background(), time.Now().UTC())
+
+		if rec.received() != 1 {
+			t.Fatalf("got %d deliveries, want 1", rec.received())
+		}
+		if got, want := rec.signature[0], signWebhookPayload(sub.Secret, rec.bodies[0]); got != want {
+			t.Errorf("got signature %q, want %q", got, want)
+		}
+		var e PersonEvent
+		json.Unmarshal(rec.bodies[0], &e)
+		if e.Type != PersonCreated || e.PersonID != joe.ID {
+			t.Errorf("unexpected event %+v", e)
+		}
+		if len(store.Pending()) != 0 {
+			t.Errorf("delivery was not removed from the queue")
+		}
+	})
+
+	t.Run("filter by event and communication kind", func(t *testing.T) {
+		sub := &WebhookSubscription{Events: []PersonEventType{PersonDeleted}}
+		if sub.Matches(NewPersonEvent(PersonCreated, joe)) {
+			t.Errorf("created event matched deleted filter")
+		}
+
+		sub = &WebhookSubscription{CommunicationKinds: []string{CommunicationPhone}}
+		if sub.Matches(NewPersonEvent(PersonCreated, joe)) {
+			t.Errorf("email only person matched phone filter")
+		}
+		sub.CommunicationKinds = append(sub.CommunicationKinds, CommunicationEmail)
+		if !sub.Matches(NewPersonEvent(PersonCreated, joe)) {
+			t.Errorf("email person did not match email filter")
+		}
+	})
+
+	t.Run("retry, dead letter and replay", func(t *testing.T) {
+		rec := &webhookReceiver{status: http.StatusInternalServerError}
+		receiver := httptest.NewServer(rec)
+		defer receiver.Close()
+
+		store, _ := NewWebhookStore(t.TempDir() + "/webhooks.json")
+		d := NewWebhookDispatcher(store)
+		d.maxAttempts = 2
+		d.Subscribe(&WebhookSubscription{URL: receiver.URL})
+		d.Publish(NewPersonEvent(PersonUpdated, joe))
+
+		now := time.Now().UTC()
+		d.deliverDue(context.Background(), now)
+		pending := store.Pending()
+		if len(pending) != 1 || pending[0].Attempts != 1 || !pending[0].NextAttempt.After(now) {
+			t.Fatalf("delivery was not rescheduled: %+v", pending)
+		}
+
+		d.deliverDue(context.Background(), now.Add(d.maxBackoff))
+		dead := store.DeadLetters()
+		if len(dead) != 1 || len(store.Pending()) != 0 {
+			t.Fatalf("delivery was not dead-lettered")
+		}
+
+		reloaded, err := NewWebhookStore(store.path)
+		if err != nil || len(reloaded.DeadLetters()) != 1 {
+			t.Fatalf("dead letters were not persisted: %v", err)
+		}
+
+		rec.status = http.StatusNoContent
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithWebhooks(d))
+		req, _ := http.NewRequest("POST", "/webhooks/dead-letters/"+dead[0].ID.String()+"/replay", nil)
+		setRequestAuth(req)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusAccepted)
+		d.deliverDue(context.Background(), time.Now().UTC())
+		if rec.received() != 3 || len(store.Pending()) != 0 || len(store.DeadLetters()) != 0 {
+			t.Errorf("replayed delivery was not delivered")
+		}
+	})
+
+	t.Run("failed delivery holds back later events", func(t *testing.T) {
+		rec := &webhookReceiver{status: http.StatusServiceUnavailable}
+		receiver := httptest.NewServer(rec)
+		defer receiver.Close()
+
+		store, _ := NewWebhookStore("")
+		d := NewWebhookDispatcher(store)
+		d.Subscribe(&WebhookSubscription{URL: receiver.URL})
+		d.Publish(NewPersonEvent(PersonCreated, joe))
+		d.Publish(NewPersonEvent(PersonUpdated, joe))
+
+		now := time.Now().UTC()
+		d.deliverDue(context.Background(), now)
+		if rec.received() != 1 {
+			t.Fatalf("got %d deliveries, want only the failed one", rec.received())
+		}
+
+		rec.status = http.StatusOK
+		d.Publish(NewPersonEvent(PersonDeleted, joe))
+		d.deliverDue(context.Background(), time.Now().UTC())
+		if rec.received() != 1 {
+			t.Fatalf("got %d deliveries while the first one waits for its retry", rec.received())
+		}
+
+		d.deliverDue(context.Background(), now.Add(d.maxBackoff))
+		var got []PersonEventType
+		for _, body := range rec.bodies[1:] {
+			var e PersonEvent
+			json.Unmarshal(body, &e)
+			got = append(got, e.Type)
+		}
+		want := []PersonEventType{PersonCreated, PersonUpdated, PersonDeleted}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got events %v, want %v", got, want)
+		}
+	})
+
+	t.Run("slow subscriber doesn't hold up others", func(t *testing.T) {
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer slow.Close()
+		defer close(release)
+		rec := &webhookReceiver{status: http.StatusOK}
+		fast := httptest.NewServer(rec)
+		defer fast.Close()
+
+		store, _ := NewWebhookStore("")
+		d := NewWebhookDispatcher(store)
+		d.Subscribe(&WebhookSubscription{URL: slow.URL})
+		d.Subscribe(&WebhookSubscription{URL: fast.URL})
+		d.Publish(NewPersonEvent(PersonCreated, joe))
+		d.Publish(NewPersonEvent(PersonUpdated, joe))
+
+		done := make(chan struct{})
+		go func() {
+			d.deliverDue(context.Background(), time.Now().UTC())
+			close(done)
+		}()
+		deadline := time.After(5 * time.Second)
+		for rec.received() != 2 {
+			select {
+			case <-deadline:
+				t.Fatalf("fast subscriber got %d deliveries while the slow one hung", rec.received())
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		var first PersonEvent
+		json.Unmarshal(rec.bodies[0], &first)
+		if first.Type != PersonCreated {
+			t.Errorf("deliveries out of order, first is %v", first.Type)
+		}
+		release <- struct{}{}
+		release <- struct{}{}
+		<-done
+	})
+
+	t.Run("stop gives up at the deadline", func(t *testing.T) {
+		release := make(chan struct{})
+		hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer hung.Close()
+		defer close(release)
+
+		store, _ := NewWebhookStore("")
+		d := NewWebhookDispatcher(store)
+		d.Subscribe(&WebhookSubscription{URL: hung.URL})
+		d.Publish(NewPersonEvent(PersonCreated, joe))
+		d.Publish(NewPersonEvent(PersonUpdated, joe))
+		d.Start()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		if err := d.Stop(ctx); err != context.DeadlineExceeded {
+			t.Errorf("Stop() = %v, want %v", err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(started); elapsed > time.Second {
+			t.Errorf("Stop took %v", elapsed)
+		}
+		pending := store.Pending()
+		if len(pending) != 2 || pending[0].Attempts != 0 || pending[1].Attempts != 0 {
+			t.Errorf("cancelled deliveries were not left pending: %+v", pending)
+		}
+	})
+
+	t.Run("reject invalid url", func(t *testing.T) {
+		store, _ := NewWebhookStore("")
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithWebhooks(NewWebhookDispatcher(store)))
+		for _, u := range []string{"", "crm.local/hook", "ftp://crm.local/hook", "http://", "http://%zz"} {
+			req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(`{"url": "`+u+`"}`))
+			setRequestAuth(req)
+			req.Header.Add("Content-Type", contentTypeJSON)
+			response := httptest.NewRecorder()
+
+			server.ServeHTTP(response, req)
+
+			if response.Code != http.StatusBadRequest {
+				t.Errorf("%q: got status %d, want 400", u, response.Code)
+			}
+		}
+	})
+
+	t.Run("register subscription", func(t *testing.T) {
+		store, _ := NewWebhookStore("")
+		server := NewServer(NewInMemoryPersonStorage(), logBody, WithWebhooks(NewWebhookDispatcher(store)))
+		req, _ := http.NewRequest("POST", "/webhooks", strings.NewReader(
+			`{"url": "http://crm.local/hook", "events": ["created", "updated"]}`))
+		setRequestAuth(req)
+		req.Header.Add("Content-Type", contentTypeJSON)
+		response := httptest.NewRecorder()
+
+		server.ServeHTTP(response, req)
+
+		assertStatus(t, response.Code, http.StatusCreated)
+		var sub WebhookSubscription
+		json.Unmarshal(response.Body.Bytes(), &sub)
+		if sub.Secret == "" || len(store.Subscriptions()) != 1 {
+			t.Errorf("subscription was not stored with a secret")
+		}
+	})
+}